@@ -26,9 +26,9 @@ type CgroupManager struct {
 
 // ResourceConfig holds resource limit configurations
 type ResourceConfig struct {
-	MemoryLimit string // in bytes
-	CpuShare    string // in shares (relative weight)
-	CpuSet      string // cpus the container can use, e.g., "0-1,3"
+	MemoryLimit string `json:"memoryLimit"` // in bytes
+	CpuShare    string `json:"cpuShare"`    // in shares (relative weight)
+	CpuSet      string `json:"cpuSet"`      // cpus the container can use, e.g., "0-1,3"
 }
 
 // NewCgroupManager creates a new CgroupManager instance
@@ -46,9 +46,30 @@ func (c *CgroupManager) Apply(pid int) error {
 		return err
 	}
 	// Write process ID to cgroup.procs
-	cgroupProcsPath := filepath.Join(c.getAbsolutePath(), "cgroup.procs")
+	return os.WriteFile(c.ProcsPath(), []byte(strconv.Itoa(pid)), 0700)
+}
+
+// ProcsPath returns the path of the cgroup.procs file, a process joins the cgroup by writing its pid there
+func (c *CgroupManager) ProcsPath() string {
+	return filepath.Join(c.getAbsolutePath(), "cgroup.procs")
+}
 
-	return os.WriteFile(cgroupProcsPath, []byte(strconv.Itoa(pid)), 0700)
+// GetPids returns the pids of the processes in the cgroup, as seen from the host.
+func (c *CgroupManager) GetPids() ([]int, error) {
+	procs, err := os.ReadFile(c.ProcsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, pidStr := range strings.Fields(string(procs)) {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q in cgroup.procs", pidStr)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
 }
 
 func (c *CgroupManager) Set(res *ResourceConfig) error {
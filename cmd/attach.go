@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/shim"
+	"github.com/crazyfrankie/zdocker/term"
+)
+
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+var errDetached = errors.New("detached from container")
+
+type attachOptions struct {
+	detachKeys string
+	noStdin    bool
+}
+
+func NewAttachCommand() *cobra.Command {
+	var option attachOptions
+
+	cmd := &cobra.Command{
+		Use:   "attach [OPTIONS] [CONTAINER]",
+		Short: "Attach local standard input and output to a running container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			return attachContainer(args[0], option)
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&option.detachKeys, "detach-keys", "", defaultDetachKeys, "key sequence for detaching from the container")
+	flags.BoolVarP(&option.noStdin, "no-stdin", "", false, "do not attach stdin")
+
+	return cmd
+}
+
+func attachContainer(containerName string, option attachOptions) error {
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	containerName = info.Name
+	if info.Status != container.RUNNING {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	keys, err := parseDetachKeys(option.detachKeys)
+	if err != nil {
+		return err
+	}
+
+	socketPath := fmt.Sprintf(container.DefaultLocation, containerName) + container.AttachSocket
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("container %s can not be attached: %v", containerName, err)
+	}
+	defer conn.Close()
+
+	stdinIsTerminal := term.IsTerminal(os.Stdin.Fd())
+	if info.TTY && stdinIsTerminal && !option.noStdin {
+		oldState, err := term.SetRawTerminal(os.Stdin.Fd())
+		if err != nil {
+			return fmt.Errorf("set raw terminal error %v", err)
+		}
+		defer term.RestoreTerminal(os.Stdin.Fd(), oldState)
+	}
+	if info.TTY && stdinIsTerminal {
+		sendResize(conn)
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				sendResize(conn)
+			}
+		}()
+	}
+
+	outputDone := make(chan struct{})
+	go func() {
+		// the shim closes the connection once the container exits
+		io.Copy(os.Stdout, conn)
+		close(outputDone)
+	}()
+
+	inputDone := make(chan error, 1)
+	if !option.noStdin {
+		go func() {
+			inputDone <- copyAttachInput(conn, os.Stdin, keys)
+		}()
+	}
+
+	select {
+	case <-outputDone:
+	case err := <-inputDone:
+		if errors.Is(err, errDetached) {
+			fmt.Fprintf(os.Stderr, "\r\n%s\r\n", errDetached)
+			return nil
+		}
+		// stdin is exhausted, keep streaming the output until the container exits
+		<-outputDone
+	}
+
+	return nil
+}
+
+// copyAttachInput forwards input to the container until the detach key sequence is read.
+// Bytes that start the sequence are held back, and sent if the sequence turns out not to match.
+func copyAttachInput(conn net.Conn, in io.Reader, keys []byte) error {
+	buf := make([]byte, 1024)
+	matched := 0
+	for {
+		n, err := in.Read(buf)
+		out := make([]byte, 0, n+matched)
+		for _, b := range buf[:n] {
+			if len(keys) == 0 {
+				out = append(out, b)
+				continue
+			}
+			if b == keys[matched] {
+				matched++
+				if matched == len(keys) {
+					if len(out) > 0 {
+						shim.WriteFrame(conn, shim.FrameStdin, out)
+					}
+					return errDetached
+				}
+				continue
+			}
+			out = append(out, keys[:matched]...)
+			matched = 0
+			if b == keys[0] {
+				matched = 1
+				continue
+			}
+			out = append(out, b)
+		}
+		if len(out) > 0 {
+			if werr := shim.WriteFrame(conn, shim.FrameStdin, out); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sendResize(conn net.Conn) {
+	rows, cols, err := term.GetSize(os.Stdin.Fd())
+	if err != nil {
+		log.Warnf("get terminal size error %v", err)
+		return
+	}
+	if err := shim.WriteResize(conn, rows, cols); err != nil {
+		log.Warnf("send terminal size error %v", err)
+	}
+}
+
+// parseDetachKeys parses a comma separated key sequence like "ctrl-p,ctrl-q".
+// A key is either a single character or ctrl- followed by a letter or one of @[\]^_,
+// an empty string disables detaching.
+func parseDetachKeys(keys string) ([]byte, error) {
+	if keys == "" {
+		return nil, nil
+	}
+
+	var seq []byte
+	for _, key := range strings.Split(keys, ",") {
+		lower := strings.ToLower(key)
+		switch {
+		case len(key) == 1:
+			seq = append(seq, key[0])
+		case strings.HasPrefix(lower, "ctrl-") && len(key) == 6:
+			c := lower[5]
+			switch {
+			case c >= 'a' && c <= 'z':
+				seq = append(seq, c-'a'+1)
+			case c == '@':
+				seq = append(seq, 0)
+			case c >= '[' && c <= '_':
+				seq = append(seq, c-'['+27)
+			default:
+				return nil, fmt.Errorf("invalid detach key %q", key)
+			}
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+
+	return seq, nil
+}
@@ -37,6 +37,10 @@ func NewCommitCommand() *cobra.Command {
 }
 
 func commitContainer(containerName string, imageName string) {
+	// the rootfs of the container is mounted under its name, not its ID
+	if info, err := getContainerInfoByName(containerName); err == nil {
+		containerName = info.Name
+	}
 	mntUrl := fmt.Sprintf(container.MntUrl, containerName)
 	mntUrl += "/"
 
@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// maxSymlinks is how many symbolic links resolving a path may follow, like the kernel's limit
+const maxSymlinks = 40
+
+// copyLocation is a path on the host, whose root is /, or in a container, whose root is its merged rootfs.
+type copyLocation struct {
+	root string
+	path string
+}
+
+func NewCopyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cp CONTAINER:SRC_PATH DEST_PATH|- | SRC_PATH|- CONTAINER:DEST_PATH",
+		Short: "Copy files between a container and the host",
+		Long: `Copy files between a container and the host, whether the container runs or not.
+A SRC_PATH ending with /. copies the contents of the directory.
+With - as DEST_PATH the files are written to stdout as a tar archive,
+with - as SRC_PATH a tar archive read from stdin is extracted into the directory DEST_PATH.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("cp requires 2 arguments")
+			}
+			return copyFiles(args[0], args[1])
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	return cmd
+}
+
+func copyFiles(srcArg string, dstArg string) error {
+	srcContainer, srcPath := splitCopyArg(srcArg)
+	dstContainer, dstPath := splitCopyArg(dstArg)
+	if (srcContainer == "") == (dstContainer == "") {
+		return errors.New("copying between containers or within the host is not supported, one of the paths must be CONTAINER:PATH")
+	}
+	if srcPath == "" || dstPath == "" {
+		return errors.New("missing path")
+	}
+
+	src, err := newCopyLocation(srcContainer, srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := newCopyLocation(dstContainer, dstPath)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case dstPath == "-":
+		// SRC/. puts the contents of SRC at the top of the archive
+		name := filepath.Base(src.path)
+		if copyContentsOnly(srcPath) || name == "/" {
+			name = "."
+		}
+		return writeTar(os.Stdout, src, name)
+	case srcPath == "-":
+		dir, err := dst.resolve()
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("destination %s must be an existing directory", dstPath)
+		}
+		return extractTar(os.Stdin, dst)
+	}
+
+	return copyPath(src, copyContentsOnly(srcPath), dst, strings.HasSuffix(dstPath, "/"))
+}
+
+// splitCopyArg splits CONTAINER:PATH, a path that is absolute or starts with . is on the host.
+func splitCopyArg(arg string) (string, string) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	containerName, path, ok := strings.Cut(arg, ":")
+	if !ok || strings.Contains(containerName, "/") {
+		return "", arg
+	}
+	return containerName, path
+}
+
+// newCopyLocation locates path on the host when containerName is empty, in the container otherwise.
+// The rootfs of a container that is not running is mounted again, along with its volume,
+// so that a path in the volume is the one on the host.
+func newCopyLocation(containerName string, path string) (*copyLocation, error) {
+	if containerName == "" {
+		if path == "-" {
+			return &copyLocation{root: "/", path: path}, nil
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		return &copyLocation{root: "/", path: abs}, nil
+	}
+
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return nil, fmt.Errorf("no such container: %s", containerName)
+	}
+	container.NewWorkSpace(info.Image, info.Name, info.Volume)
+
+	return &copyLocation{
+		root: fmt.Sprintf(container.MntUrl, info.Name),
+		path: filepath.Join("/", path),
+	}, nil
+}
+
+// copyContentsOnly tells whether path asks for the contents of a directory, SRC/.
+func copyContentsOnly(path string) bool {
+	return path == "." || strings.HasSuffix(path, "/.")
+}
+
+// copyPath copies src to dst the way cp -r does: into dst when it is a directory,
+// as dst otherwise. The files go through a tar stream, the same one cp - reads and writes.
+func copyPath(src *copyLocation, contentsOnly bool, dst *copyLocation, dstMustBeDir bool) error {
+	srcResolved, err := src.resolve()
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Lstat(srcResolved)
+	if err != nil {
+		return fmt.Errorf("could not find the file %s: %v", src.path, err)
+	}
+	dstResolved, err := dst.resolve()
+	if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dstResolved)
+	dstExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// the archive is extracted into dir, its top entry named name
+	dir := &copyLocation{root: dst.root, path: dst.path}
+	name := filepath.Base(src.path)
+	switch {
+	case dstExists && dstInfo.IsDir():
+		if contentsOnly && srcInfo.IsDir() {
+			name = "."
+		}
+	case dstExists && srcInfo.IsDir():
+		return fmt.Errorf("cannot copy a directory to the file %s", dst.path)
+	case !dstExists && dstMustBeDir && !srcInfo.IsDir():
+		return fmt.Errorf("destination directory %s does not exist", dst.path)
+	default:
+		// dst is created by the copy, or a file it replaces
+		dir.path = filepath.Dir(dst.path)
+		name = filepath.Base(dst.path)
+		parent, err := dir.resolve()
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(parent); err != nil || !fi.IsDir() {
+			return fmt.Errorf("destination directory %s does not exist", dir.path)
+		}
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTar(writer, src, name))
+	}()
+	err = extractTar(reader, dir)
+	// let the writer return if extracting stopped early
+	reader.CloseWithError(err)
+
+	return err
+}
+
+// resolve returns the path on the host of l.path. Symbolic links are followed within the root
+// of the location, except for the last component: a link is copied as a link.
+func (l *copyLocation) resolve() (string, error) {
+	path := filepath.Clean(l.path)
+	if path == "/" {
+		return l.root, nil
+	}
+	dir, err := resolveInRoot(l.root, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// resolveInRoot resolves path as if root were /: neither .. nor a symbolic link,
+// even an absolute one, leads out of root. Components that do not exist are kept as they are.
+func resolveInRoot(root string, path string) (string, error) {
+	current := "/"
+	links := 0
+	for path != "" {
+		var part string
+		part, path, _ = strings.Cut(path, "/")
+		if part == "" || part == "." {
+			continue
+		}
+		next := filepath.Join(current, part)
+
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+			current = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links in %s", next)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		path = target + "/" + path
+	}
+
+	return filepath.Join(root, current), nil
+}
+
+// writeTar writes src to w as a tar archive, the entries of a directory under name.
+func writeTar(w io.Writer, src *copyLocation, name string) error {
+	srcResolved, err := src.resolve()
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(srcResolved, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcResolved, path)
+		if err != nil {
+			return err
+		}
+		entryName := filepath.Join(name, rel)
+		if entryName == "." {
+			// the directory the contents are copied into exists already
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			// sockets can not be archived
+			log.Warnf("skip %s: %v", path, err)
+			return nil
+		}
+		header.Name = entryName
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archive %s error %v", src.path, err)
+	}
+
+	return tw.Close()
+}
+
+// extractTar extracts the tar archive read from r into the directory dir.
+// The entries are placed as if the root of dir were /, so none ends up outside of it.
+func extractTar(r io.Reader, dir *copyLocation) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar archive error %v", err)
+		}
+
+		entry := &copyLocation{root: dir.root, path: filepath.Join(dir.path, filepath.Join("/", header.Name))}
+		target, err := entry.resolve()
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(header.Mode).Perm()
+		// a link in the place of the entry would be followed out of dir
+		if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode); err != nil {
+				return err
+			}
+			err = os.Chmod(target, mode)
+		case tar.TypeReg:
+			err = extractFile(tr, target, mode)
+		case tar.TypeSymlink:
+			os.RemoveAll(target)
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeLink:
+			// the target of a hard link is an entry of the archive as well
+			link := &copyLocation{root: dir.root, path: filepath.Join(dir.path, filepath.Join("/", header.Linkname))}
+			var source string
+			if source, err = link.resolve(); err == nil {
+				os.Remove(target)
+				err = os.Link(source, target)
+			}
+		default:
+			log.Warnf("skip %s: unsupported file type %c", header.Name, header.Typeflag)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("extract %s error %v", header.Name, err)
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// the mode of a file that existed is not changed by opening it
+	return os.Chmod(target, mode)
+}
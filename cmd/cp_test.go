@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCopyArg(t *testing.T) {
+	cases := []struct {
+		arg           string
+		wantContainer string
+		wantPath      string
+	}{
+		{arg: "c:/p", wantContainer: "c", wantPath: "/p"},
+		{arg: "c:p", wantContainer: "c", wantPath: "p"},
+		{arg: "./a:b", wantPath: "./a:b"},
+		{arg: "/x:y", wantPath: "/x:y"},
+		{arg: "a/b:c", wantPath: "a/b:c"},
+		{arg: "file", wantPath: "file"},
+		{arg: "-", wantPath: "-"},
+	}
+
+	for _, c := range cases {
+		containerName, path := splitCopyArg(c.arg)
+		if containerName != c.wantContainer || path != c.wantPath {
+			t.Fatalf("splitCopyArg(%q) = %q, %q, want %q, %q", c.arg, containerName, path, c.wantContainer, c.wantPath)
+		}
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := errors.Join(
+		os.MkdirAll(root+"/etc", 0755),
+		os.WriteFile(root+"/etc/passwd", []byte("root:x:0:0::/root:/bin/sh\n"), 0644),
+		os.MkdirAll(root+"/dir/sub", 0755),
+		os.Symlink("/etc", root+"/abs"),
+		os.Symlink("../../../../../etc", root+"/rel"),
+		os.Symlink(outside, root+"/outside"),
+		os.Symlink("..", root+"/dir/up"),
+		os.Symlink("loop2", root+"/loop1"),
+		os.Symlink("/loop1", root+"/loop2"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "/etc/passwd", want: "/etc/passwd"},
+		{path: "/../../etc", want: "/etc"},
+		{path: "/dir/../../../etc/passwd", want: "/etc/passwd"},
+		{path: "/abs/passwd", want: "/etc/passwd"},
+		{path: "/rel/passwd", want: "/etc/passwd"},
+		{path: "/outside/file", want: outside + "/file"},
+		{path: "/dir/up/dir/sub", want: "/dir/sub"},
+		{path: "/missing/file", want: "/missing/file"},
+		{path: "/loop1", wantErr: true},
+		{path: "/loop1/file", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := resolveInRoot(root, c.path)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("resolveInRoot(%q) error %v", c.path, err)
+		}
+		if err == nil && got != filepath.Join(root, c.want) {
+			t.Fatalf("resolveInRoot(%q) = %q, want %q", c.path, got, filepath.Join(root, c.want))
+		}
+	}
+
+	// the last component is a link to copy, not to follow
+	l := &copyLocation{root: root, path: "/abs/../abs"}
+	if got, err := l.resolve(); err != nil || got != root+"/abs" {
+		t.Fatalf("resolve(%q) = %q, %v", l.path, got, err)
+	}
+}
+
+func TestExtractTarOverSymlink(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := errors.Join(
+		os.WriteFile(outside+"/file", []byte("outside"), 0644),
+		os.MkdirAll(root+"/dst", 0755),
+		os.Symlink(outside+"/file", root+"/dst/file"),
+		os.Symlink(outside, root+"/dst/dir"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	entries := []struct {
+		header  tar.Header
+		content string
+	}{
+		{header: tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644}, content: "replaced"},
+		{header: tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644}, content: "in dir"},
+		{header: tar.Header{Name: "../../escape", Typeflag: tar.TypeReg, Mode: 0644}, content: "escape"},
+	}
+	for _, e := range entries {
+		e.header.Size = int64(len(e.content))
+		if err := tw.WriteHeader(&e.header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractTar(&archive, &copyLocation{root: root, path: "/dst"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(outside + "/file"); string(data) != "outside" {
+		t.Fatalf("file outside of the root overwritten with %q", data)
+	}
+	fi, err := os.Lstat(root + "/dst/file")
+	if err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("link not replaced by the file: %v", err)
+	}
+	if data, _ := os.ReadFile(root + "/dst/dir/file"); string(data) != "in dir" {
+		t.Fatalf("file in the directory replacing the link holds %q", data)
+	}
+	if data, _ := os.ReadFile(root + "/dst/escape"); string(data) != "escape" {
+		t.Fatalf("entry with .. not kept in the destination: %q", data)
+	}
+}
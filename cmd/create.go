@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/network"
+)
+
+func NewCreateCommand() *cobra.Command {
+	var option runOptions
+
+	cmd := &cobra.Command{
+		Use:          "create [OPTIONS] IMAGE [COMMAND] [ARG...]",
+		Short:        "Create a container without starting it",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("missing container command")
+			}
+			// a created container is started in the background, a shell is only of use with a tty to attach to
+			info, err := newContainerInfo(option, args, !option.enableTTY)
+			if err != nil {
+				return err
+			}
+			if err := createContainer(info); err != nil {
+				return fmt.Errorf("create container %s error %v", info.Name, err)
+			}
+			fmt.Println(info.Name)
+
+			return nil
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	cmd.Flags().SetInterspersed(false)
+	addContainerFlags(cmd, &option)
+
+	return cmd
+}
+
+// createContainer prepares what the container described by info needs to start:
+// its rootfs, its cgroup and its network address, and records it in the created state.
+func createContainer(info *container.ContainerInfo) (err error) {
+	dirUrl := fmt.Sprintf(container.DefaultLocation, info.Name)
+	if _, err := os.Stat(dirUrl + container.ConfigName); err == nil {
+		return fmt.Errorf("container name %s is already in use", info.Name)
+	}
+
+	container.NewWorkSpace(info.Image, info.Name, info.Volume)
+	cgroupManager := cgroups.NewCgroupManager(path.Join("zdocker", info.ID))
+	defer func() {
+		if err == nil {
+			return
+		}
+		if info.IPAddress != "" {
+			network.Disconnect(info.Network, info)
+		}
+		cgroupManager.Destroy()
+		if err := removeContainerFiles(info); err != nil {
+			log.Errorf("Remove container %s error %v", info.Name, err)
+		}
+	}()
+
+	if info.Resource != nil {
+		if err := cgroupManager.Set(info.Resource); err != nil {
+			return err
+		}
+	}
+	if info.Network != "" {
+		network.InitNetwork()
+		if err := network.Allocate(info.Network, info); err != nil {
+			return fmt.Errorf("allocate address on network %s error %v", info.Network, err)
+		}
+	}
+
+	info.Status = container.CREATED
+	info.CreateTime = time.Now().Format(time.DateTime)
+
+	return writeContainerInfo(info)
+}
@@ -1,33 +1,60 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/bytedance/sonic"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/crazyfrankie/zdocker/cgroups"
 	"github.com/crazyfrankie/zdocker/container"
 	_ "github.com/crazyfrankie/zdocker/nsenter"
+	"github.com/crazyfrankie/zdocker/term"
 )
 
 const EnvExecPID = "zdocker_pid"
+
+// EnvExecCMD carries the ExecSpec of the process as JSON.
 const EnvExecCMD = "zdocker_cmd"
 
+// EnvExecCgroup is the cgroup.procs file of the cgroup of the container.
+const EnvExecCgroup = "zdocker_cgroup"
+
+type execOptions struct {
+	interactive  bool
+	enableTTY    bool
+	detach       bool
+	workdir      string
+	user         string
+	environments []string
+}
+
 func NewExecCommand() *cobra.Command {
+	var option execOptions
+
 	cmd := &cobra.Command{
-		Use:   "exec [CONTAINER] [COMMAND] [ARG...]",
+		Use:   "exec [OPTIONS] [CONTAINER] [COMMAND] [ARG...]",
 		Short: "exec a command into container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// This is for callback
+			// This is for callback: the nsenter constructor has joined the container
 			if os.Getenv(EnvExecPID) != "" {
-				log.Infof("pid callback pid %d", os.Getgid())
+				runExecCallback()
 				return nil
 			}
+			// This is the monitor of a detached exec session started by startDetachedExec
+			if sessionID := os.Getenv(EnvExecSession); sessionID != "" {
+				return runDetachedExec(sessionID, args, option)
+			}
 			// we expected zdocker exec [container] [command]
 			if len(args) < 2 {
 				return errors.New("missing container name or command")
@@ -35,66 +62,228 @@ func NewExecCommand() *cobra.Command {
 			containerName := args[0]
 			commands := args[1:]
 
-			ExecContainer(containerName, commands)
+			if option.detach {
+				if option.interactive || option.enableTTY {
+					return errors.New("conflicting options: -d and -i/-t")
+				}
+				sessionID, err := startDetachedExec(containerName, commands, option)
+				if err != nil {
+					return err
+				}
+				fmt.Println(sessionID)
+				return nil
+			}
+			exitCode, err := ExecContainer(containerName, commands, option)
+			if err != nil {
+				return err
+			}
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
 
 			return nil
 		},
 		DisableFlagsInUseLine: true,
 	}
 
+	flags := cmd.Flags()
+	flags.SetInterspersed(false)
+	flags.BoolVarP(&option.interactive, "interactive", "i", false, "keep stdin open")
+	flags.BoolVarP(&option.enableTTY, "tty", "t", false, "allocate a pseudo-tty")
+	flags.BoolVarP(&option.detach, "detach", "d", false, "run the command in the background and print the exec session ID")
+	flags.StringVarP(&option.workdir, "workdir", "w", "", "working directory inside the container")
+	flags.StringVarP(&option.user, "user", "u", "", "username or UID (format: <name|uid>[:<group|gid>])")
+	flags.StringArrayVarP(&option.environments, "env", "e", []string{}, "set environment variables (e.g., -e KEY1=value1 -e KEY2=value2)")
+
 	return cmd
 }
 
-func ExecContainer(containerName string, commands []string) {
-	pid, err := getContainerPIDByName(containerName)
+// ExecContainer runs commands in the container and returns their exit code.
+func ExecContainer(containerName string, commands []string, option execOptions) (int, error) {
+	session := &container.ExecSession{
+		ID:      randStringBytes(10),
+		Command: commands,
+	}
+	return runExecSession(containerName, session, option, func(error) {})
+}
+
+// runExecSession runs the command of session in the container, records the session
+// and returns the exit code of the command. started is called with nil once the command runs,
+// or with the error that prevented it from running.
+func runExecSession(containerName string, session *container.ExecSession, option execOptions, started func(error)) (int, error) {
+	exitCode, err := execSession(containerName, session, option, started)
+	if err != nil {
+		started(err)
+	}
+	return exitCode, err
+}
+
+func execSession(containerName string, session *container.ExecSession, option execOptions, started func(error)) (int, error) {
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return 0, fmt.Errorf("get info of container %s error %v", containerName, err)
+	}
+	containerName = info.Name
+	if info.PID == "" {
+		return 0, fmt.Errorf("container %s is not running", containerName)
+	}
+	log.Debugf("container pid %s command %q", info.PID, session.Command)
+
+	cmd, err := newExecCommand(context.Background(), info, &container.ExecSpec{
+		Args: session.Command,
+		Env:  mergeEnv(info.Env, option.environments),
+		Dir:  option.workdir,
+		User: option.user,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var pty *term.Pty
+	if option.enableTTY {
+		pty, err = term.NewPty()
+		if err != nil {
+			return 0, fmt.Errorf("new pty error %v", err)
+		}
+		defer pty.Master.Close()
+		cmd.Stdin = pty.Slave
+		cmd.Stdout = pty.Slave
+		cmd.Stderr = pty.Slave
+		// leave our terminal, the command takes the pty as its controlling terminal
+		// once it runs in the container
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		cmd.Env = append(cmd.Env, "ZDOCKER_TTY=1")
+	} else if !session.Detached {
+		if option.interactive {
+			cmd.Stdin = os.Stdin
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+
+	// the nsenter constructor reports the pid of the command on fd 3
+	pidRead, pidWrite, err := os.Pipe()
 	if err != nil {
-		log.Errorf("Exec container getContainerPIDByName %s error %v", containerName, err)
-		return
+		return 0, fmt.Errorf("new pipe error %v", err)
 	}
+	defer pidRead.Close()
+	cmd.ExtraFiles = []*os.File{pidWrite}
+	cmd.Env = append(cmd.Env, "ZDOCKER_PID_FD=3")
 
-	cmds := strings.Join(commands, " ")
-	log.Infof("container pid %s", pid)
-	log.Infof("command %s", cmds)
+	if err := cmd.Start(); err != nil {
+		pidWrite.Close()
+		return 0, fmt.Errorf("exec container %s error %v", containerName, err)
+	}
+	pidWrite.Close()
+	pid, err := io.ReadAll(pidRead)
+	if err != nil {
+		log.Warnf("read pid of exec session %s error %v", session.ID, err)
+	}
 
-	cmd := exec.Command("/proc/self/exe", "exec")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	session.PID = string(pid)
+	session.Running = true
+	session.StartTime = time.Now().Format(time.DateTime)
+	if err := writeExecSession(containerName, session); err != nil {
+		log.Warnf("record exec session %s error %v", session.ID, err)
+	}
+	started(nil)
 
-	os.Setenv(EnvExecPID, pid)
-	os.Setenv(EnvExecCMD, cmds)
-	containerEnvs := getEnvsByPid(pid)
-	cmd.Env = append(cmd.Environ(), containerEnvs...)
+	restore := func() {}
+	if pty != nil {
+		pty.Slave.Close()
+		var stdin *os.File
+		if option.interactive {
+			stdin = os.Stdin
+		}
+		restore = term.Relay(pty, stdin, os.Stdout)
+	}
+	// the error only tells that the command did not exit with 0, which the wait status has as well
+	cmd.Wait()
+	restore()
 
-	if err := cmd.Run(); err != nil {
-		log.Errorf("Exec container %s error %v", containerName, err)
+	exitCode, _ := exitStatus(cmd.ProcessState)
+	session.Running = false
+	session.ExitCode = exitCode
+	session.FinishTime = time.Now().Format(time.DateTime)
+	if err := writeExecSession(containerName, session); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("record exit of exec session %s error %v", session.ID, err)
 	}
+
+	return exitCode, nil
 }
 
-func getContainerPIDByName(containerName string) (string, error) {
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
-	cfgFile := dirUrl + container.ConfigName
-	content, err := os.ReadFile(cfgFile)
+// newExecCommand builds the command that runs the process described by spec in the container:
+// it joins the cgroup and the namespaces of the main process of the container,
+// and gets the security context of that process.
+func newExecCommand(ctx context.Context, info *container.ContainerInfo, spec *container.ExecSpec) (*exec.Cmd, error) {
+	pid, err := strconv.Atoi(info.PID)
+	if err != nil {
+		return nil, fmt.Errorf("convert pid from string to int error %v", err)
+	}
+	if spec.Security, err = container.ReadSecurity(pid); err != nil {
+		return nil, fmt.Errorf("read security context of container %s error %v", info.Name, err)
+	}
+	data, err := sonic.Marshal(spec)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var containerInfo container.ContainerInfo
-	if err := sonic.Unmarshal(content, &containerInfo); err != nil {
-		return "", err
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", "exec")
+	cmd.Env = append(os.Environ(), EnvExecPID+"="+info.PID, EnvExecCMD+"="+string(data))
+	if info.CgroupPath != "" {
+		// the nsenter constructor joins the cgroup before it forks the process
+		cmd.Env = append(cmd.Env, EnvExecCgroup+"="+cgroups.NewCgroupManager(info.CgroupPath).ProcsPath())
 	}
 
-	return containerInfo.PID, nil
+	return cmd, nil
 }
 
-func getEnvsByPid(pid string) []string {
-	path := fmt.Sprintf("/proc/%s/environ", pid)
-	content, err := os.ReadFile(path)
-	if err != nil {
-		log.Errorf("Read file %s error %v", path, err)
-		return nil
+// runExecCallback runs in the namespaces of the container, it never returns.
+// Like a shell, it exits with 127 when the command is not found and 126 when it can not be run.
+func runExecCallback() {
+	var spec container.ExecSpec
+	if err := sonic.Unmarshal([]byte(os.Getenv(EnvExecCMD)), &spec); err != nil {
+		fmt.Fprintf(os.Stderr, "zdocker: invalid exec spec: %v\n", err)
+		os.Exit(126)
+	}
+
+	err := container.RunExecProcess(&spec)
+	fmt.Fprintf(os.Stderr, "zdocker: %v\n", err)
+	if errors.Is(err, exec.ErrNotFound) {
+		os.Exit(127)
+	}
+	os.Exit(126)
+}
+
+// mergeEnv overrides the variables of base by those given with -e,
+// a variable given without a value takes ours.
+func mergeEnv(base []string, overrides []string) []string {
+	env := make([]string, 0, len(base)+len(overrides))
+	index := map[string]int{}
+	set := func(kv string) {
+		key, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[key]; ok {
+			env[i] = kv
+			return
+		}
+		index[key] = len(env)
+		env = append(env, kv)
 	}
-	//env split by \u0000
-	envs := strings.Split(string(content), "\u0000")
-	return envs
+
+	for _, kv := range base {
+		if kv != "" {
+			set(kv)
+		}
+	}
+	for _, kv := range overrides {
+		if !strings.Contains(kv, "=") {
+			value, ok := os.LookupEnv(kv)
+			if !ok {
+				continue
+			}
+			kv += "=" + value
+		}
+		set(kv)
+	}
+
+	return env
 }
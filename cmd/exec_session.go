@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/bytedance/sonic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// EnvExecSession tells exec that it is the monitor of the detached exec session with this ID.
+const EnvExecSession = "ZDOCKER_EXEC_SESSION"
+
+func NewExecListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec-ls [CONTAINER]",
+		Short: "List the exec sessions of a container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("exec-ls requires 1 argument")
+			}
+			return listExecSessions(args[0])
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	return cmd
+}
+
+func listExecSessions(containerName string) error {
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	containerName = info.Name
+	sessions, err := readExecSessions(containerName)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "ID\tPID\tSTATUS\tCOMMAND\tSTARTED\tFINISHED\n")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			session.ID,
+			session.PID,
+			execSessionStatus(session),
+			strings.Join(session.Command, " "),
+			session.StartTime,
+			session.FinishTime,
+		)
+	}
+
+	return w.Flush()
+}
+
+// execSessionStatus is the status shown by exec-ls. The status of a session whose process is gone
+// without its exit being recorded is unknown, the exec running it was killed.
+func execSessionStatus(session *container.ExecSession) string {
+	var status string
+	switch {
+	case !session.Running:
+		status = fmt.Sprintf("exited (%d)", session.ExitCode)
+	case isProcessRunning(session.PID):
+		status = "running"
+	default:
+		return "unknown"
+	}
+	if session.Detached {
+		status += ", detached"
+	}
+	return status
+}
+
+// startDetachedExec starts a monitor in its own session that runs the command in the container,
+// and returns the session ID once the command runs. Like the shim, the monitor reports back
+// through the pipe on its fd 3: closing it without writing means the command is running,
+// anything written is the error.
+func startDetachedExec(containerName string, commands []string, option execOptions) (string, error) {
+	sessionID := randStringBytes(10)
+
+	args := []string{"exec", "--log-level", log.GetLevel().String()}
+	for _, env := range option.environments {
+		args = append(args, "--env", env)
+	}
+	if option.workdir != "" {
+		args = append(args, "--workdir", option.workdir)
+	}
+	if option.user != "" {
+		args = append(args, "--user", option.user)
+	}
+	args = append(args, containerName)
+	args = append(args, commands...)
+
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	defer readyRead.Close()
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Env = append(os.Environ(), EnvExecSession+"="+sessionID)
+	cmd.ExtraFiles = []*os.File{readyWrite}
+	// the monitor must outlive this process and the user's terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// its diagnostics go where those of the shim go
+	runtimeLog, err := os.OpenFile(fmt.Sprintf(container.DefaultLocation, containerName)+container.RuntimeLogFile,
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err == nil {
+		defer runtimeLog.Close()
+		cmd.Stderr = runtimeLog
+	}
+	if err := cmd.Start(); err != nil {
+		readyWrite.Close()
+		return "", fmt.Errorf("start exec monitor error %v", err)
+	}
+	readyWrite.Close()
+
+	msg, err := io.ReadAll(readyRead)
+	if err != nil {
+		return "", fmt.Errorf("read exec monitor ready pipe error %v", err)
+	}
+	if len(msg) > 0 {
+		return "", errors.New(string(msg))
+	}
+
+	// the monitor is not waited on, it is reparented once we exit
+	return sessionID, cmd.Process.Release()
+}
+
+// runDetachedExec runs the detached exec session sessionID until its command exits.
+func runDetachedExec(sessionID string, args []string, option execOptions) error {
+	ready := os.NewFile(uintptr(3), "ready")
+	started := func(err error) {
+		if err != nil {
+			ready.WriteString(err.Error())
+		}
+		ready.Close()
+	}
+	if len(args) < 2 {
+		err := errors.New("missing container name or command")
+		started(err)
+		return err
+	}
+
+	session := &container.ExecSession{
+		ID:       sessionID,
+		Command:  args[1:],
+		Detached: true,
+	}
+	exitCode, err := runExecSession(args[0], session, option, started)
+	if err != nil {
+		return err
+	}
+	log.Infof("exec session %s of container %s exited with code %d", sessionID, args[0], exitCode)
+
+	return nil
+}
+
+// writeExecSession saves the session under the directory of the container.
+// Each session is written by the process running it only, so unlike the container info
+// it needs no lock, and the rename keeps readers from seeing a partial write.
+func writeExecSession(containerName string, session *container.ExecSession) error {
+	data, err := sonic.Marshal(session)
+	if err != nil {
+		return err
+	}
+	// the directory of the container is not created here, it is gone once the container is removed
+	execDir := filepath.Join(fmt.Sprintf(container.DefaultLocation, containerName), container.ExecDir)
+	if err := os.Mkdir(execDir, 0622); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	fileName := filepath.Join(execDir, session.ID+".json")
+	tmpName := fileName + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0622); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, fileName)
+}
+
+// readExecSessions returns the exec sessions of the container, the oldest first.
+func readExecSessions(containerName string) ([]*container.ExecSession, error) {
+	execDir := filepath.Join(fmt.Sprintf(container.DefaultLocation, containerName), container.ExecDir)
+	entries, err := os.ReadDir(execDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*container.ExecSession
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(execDir, entry.Name()))
+		if err != nil {
+			log.Errorf("read exec session %s error %v", entry.Name(), err)
+			continue
+		}
+		var session container.ExecSession
+		if err := sonic.Unmarshal(content, &session); err != nil {
+			log.Errorf("unmarshal exec session %s error %v", entry.Name(), err)
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].StartTime < sessions[j].StartTime
+	})
+
+	return sessions, nil
+}
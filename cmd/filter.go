@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// containerFilter selects containers by the key=value conditions given with --filter.
+// A container must match every key, and any of the values given for a key.
+type containerFilter map[string][]string
+
+// containerStatuses are the values the status filter accepts.
+var containerStatuses = []string{container.CREATED, container.RUNNING, container.RESTARTING, container.STOP, container.EXIT}
+
+// parseContainerFilter parses the --filter values, each a comma separated list of key=value.
+func parseContainerFilter(values []string) (containerFilter, error) {
+	filter := containerFilter{}
+	for _, value := range values {
+		for _, condition := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(condition, "=")
+			if !ok || val == "" {
+				return nil, fmt.Errorf("bad format of filter %q, expected key=value", condition)
+			}
+			switch key {
+			case "id", "name", "label":
+			case "status":
+				if !slices.Contains(containerStatuses, val) {
+					return nil, fmt.Errorf("invalid filter 'status=%s', expected one of %s", val, strings.Join(containerStatuses, ", "))
+				}
+			default:
+				return nil, fmt.Errorf("invalid filter %q", key)
+			}
+			filter[key] = append(filter[key], val)
+		}
+	}
+
+	return filter, nil
+}
+
+// has tells whether the filter has conditions on key.
+func (f containerFilter) has(key string) bool {
+	return len(f[key]) > 0
+}
+
+// selectContainers returns the containers named in args followed by those matching the --filter values.
+// Of the containers matching the filter, only those keep returns true for are selected, all of them if it is nil.
+func selectContainers(args []string, filters []string, keep func(info *container.ContainerInfo) bool) ([]string, error) {
+	if len(filters) == 0 {
+		if len(args) < 1 {
+			return nil, errors.New("missing container name")
+		}
+		return args, nil
+	}
+	names, err := filterContainerNames(filters, keep)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.Contains(args, name) {
+			args = append(args, name)
+		}
+	}
+	return args, nil
+}
+
+// filterContainerNames returns the names of the containers matching the --filter values that keep keeps.
+func filterContainerNames(values []string, keep func(info *container.ContainerInfo) bool) ([]string, error) {
+	filter, err := parseContainerFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	containerInfos, err := listContainerInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	return filter.names(containerInfos, keep), nil
+}
+
+// names returns the names of the containers matching the filter that keep keeps, all of them if it is nil.
+func (f containerFilter) names(containerInfos []*container.ContainerInfo, keep func(info *container.ContainerInfo) bool) []string {
+	var names []string
+	for _, info := range containerInfos {
+		if f.match(info) && (keep == nil || keep(info)) {
+			names = append(names, info.Name)
+		}
+	}
+	return names
+}
+
+// match tells whether the container matches the filter.
+// Like the name filter, the id filter matches a part of the ID.
+func (f containerFilter) match(info *container.ContainerInfo) bool {
+	for key, values := range f {
+		matched := slices.ContainsFunc(values, func(value string) bool {
+			switch key {
+			case "id":
+				return strings.Contains(info.ID, value)
+			case "name":
+				return strings.Contains(info.Name, value)
+			case "status":
+				return info.Status == value
+			case "label":
+				// label=key matches a container having the label, label=key=value the label with that value
+				key, want, withValue := strings.Cut(value, "=")
+				got, ok := info.Labels[key]
+				return ok && (!withValue || got == want)
+			}
+			return false
+		})
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
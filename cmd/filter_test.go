@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+func TestContainerFilter(t *testing.T) {
+	containers := []*container.ContainerInfo{
+		{ID: "1111", Name: "web", Status: container.RUNNING, Labels: map[string]string{"app": "web", "tier": "front"}},
+		{ID: "2222", Name: "db", Status: container.EXIT, Labels: map[string]string{"app": "db", "tier": ""}},
+		{ID: "3333", Name: "cache", Status: container.STOP},
+	}
+
+	cases := []struct {
+		filters []string
+		want    []string
+		wantErr bool
+	}{
+		{filters: nil, want: []string{"web", "db", "cache"}},
+		{filters: []string{"status=running"}, want: []string{"web"}},
+		// the values of a key are alternatives, the keys are all required
+		{filters: []string{"status=running", "status=exit"}, want: []string{"web", "db"}},
+		{filters: []string{"status=running,status=stop"}, want: []string{"web", "cache"}},
+		{filters: []string{"status=running", "status=exit", "label=app=db"}, want: []string{"db"}},
+		{filters: []string{"status=stop", "label=app"}, want: nil},
+		// label=key only asks for the label, label=key=value for its value too
+		{filters: []string{"label=tier"}, want: []string{"web", "db"}},
+		{filters: []string{"label=tier="}, want: []string{"db"}},
+		{filters: []string{"label=tier=front"}, want: []string{"web"}},
+		{filters: []string{"label=app=db", "label=tier=front"}, want: []string{"web", "db"}},
+		{filters: []string{"name=c", "id=33"}, want: []string{"cache"}},
+		{filters: []string{"status=paused"}, wantErr: true},
+		{filters: []string{"image=busybox"}, wantErr: true},
+		{filters: []string{"label"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		filter, err := parseContainerFilter(c.filters)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("parseContainerFilter(%q) error %v", c.filters, err)
+		}
+		if err != nil {
+			continue
+		}
+		if got := filter.names(containers, nil); !slices.Equal(got, c.want) {
+			t.Fatalf("filter %q matched %q, want %q", c.filters, got, c.want)
+		}
+	}
+}
+
+func TestStopFilter(t *testing.T) {
+	containers := []*container.ContainerInfo{
+		{Name: "web", Status: container.RUNNING, Labels: map[string]string{"app": "web"}},
+		{Name: "worker", Status: container.RESTARTING, Labels: map[string]string{"app": "web"}},
+		{Name: "db", Status: container.EXIT, Labels: map[string]string{"app": "db"}},
+		{Name: "new", Status: container.CREATED, Labels: map[string]string{"app": "web"}},
+	}
+
+	cases := []struct {
+		filters []string
+		want    []string
+	}{
+		{filters: []string{"label=app=web"}, want: []string{"web", "worker"}},
+		{filters: []string{"label=app"}, want: []string{"web", "worker"}},
+		// a status filter narrows the selection, it never adds the running containers
+		{filters: []string{"status=exit"}, want: nil},
+		{filters: []string{"status=created"}, want: nil},
+		{filters: []string{"status=exit", "status=restarting"}, want: []string{"worker"}},
+	}
+
+	for _, c := range cases {
+		filter, err := parseContainerFilter(c.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.names(containers, isStoppable); !slices.Equal(got, c.want) {
+			t.Fatalf("stop --filter %q selected %q, want %q", c.filters, got, c.want)
+		}
+	}
+}
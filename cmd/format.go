@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/bytedance/sonic"
+)
+
+// templateFuncs are the functions --format templates can use besides the builtin ones.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := sonic.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"split": strings.Split,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// parseFormat parses the Go template given with --format.
+func parseFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format %q: %v", format, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+const (
+	// healthOutputLimit is how much of the output of a health check is kept
+	healthOutputLimit = 4096
+	// healthStopTimeout is how long an unhealthy container gets to stop before it is killed
+	healthStopTimeout = 10
+)
+
+// monitorHealth runs the health check of the container every interval
+// until the returned function is called, which must happen once the container exits.
+func monitorHealth(info *container.ContainerInfo) func() {
+	if info.Healthcheck == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	// the container started by this run, info changes once it is restarted
+	target := *info
+	name, pid, config := target.Name, target.PID, *target.Healthcheck
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			result := runHealthCheck(ctx, &target, &config)
+			if ctx.Err() != nil {
+				// the container exited during the check, the result means nothing
+				return
+			}
+			unhealthy, err := recordHealth(name, pid, result, config.Retries)
+			if err != nil {
+				log.Errorf("record health of container %s error %v", name, err)
+				continue
+			}
+			if unhealthy {
+				log.Infof("Container %s is unhealthy", name)
+				onHealthFailure(name, pid, config.OnFailure)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-finished
+	}
+}
+
+// runHealthCheck runs the health check command inside the container
+// the same way exec runs a command.
+func runHealthCheck(ctx context.Context, info *container.ContainerInfo, config *container.HealthConfig) container.HealthResult {
+	result := container.HealthResult{Start: time.Now().Format(time.RFC3339Nano)}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	output := &limitedBuffer{limit: healthOutputLimit}
+	// the check is a shell command line, like CMD-SHELL in a Dockerfile
+	cmd, err := newExecCommand(ctx, info, &container.ExecSpec{
+		Args: []string{"/bin/sh", "-c", config.Cmd},
+		Env:  info.Env,
+	})
+	if err != nil {
+		result.ExitCode = -1
+		result.Output = err.Error()
+		return result
+	}
+	// the command forked in the container stays in the process group of the intermediate process
+	// along with its own children, killing the group on timeout leaves none of them behind
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Run()
+	result.End = time.Now().Format(time.RFC3339Nano)
+	result.Output = output.String()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Output = "health check exceeded timeout " + config.Timeout.String()
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+		result.Output = err.Error()
+	}
+
+	return result
+}
+
+// recordHealth saves the result of a health check of the container process pid,
+// and reports whether the container has just become unhealthy.
+func recordHealth(containerName string, pid string, result container.HealthResult, retries int) (bool, error) {
+	unhealthy := false
+	err := updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+		// the container may have exited or been restarted meanwhile
+		if info.Status != container.RUNNING || info.PID != pid {
+			return
+		}
+		if info.Health == nil {
+			info.Health = &container.Health{Status: container.HealthStarting}
+		}
+		unhealthy = info.Health.Record(result, retries)
+	})
+
+	return unhealthy, err
+}
+
+// onHealthFailure applies the --health-on-failure action to an unhealthy container.
+func onHealthFailure(containerName string, pid string, action string) {
+	switch action {
+	case container.HealthOnFailureKill:
+		// the restart policy still applies to a killed container
+		pidInt, err := strconv.Atoi(pid)
+		if err != nil {
+			log.Errorf("convert pid from string to int error %v", err)
+			return
+		}
+		if err := syscall.Kill(pidInt, syscall.SIGKILL); err != nil {
+			log.Errorf("kill unhealthy container %s error %v", containerName, err)
+		}
+	case container.HealthOnFailureStop:
+		if err := stopContainer(containerName, healthStopTimeout, "SIGTERM"); err != nil {
+			log.Errorf("stop unhealthy container %s error %v", containerName, err)
+		}
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
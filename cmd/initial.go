@@ -1,24 +1,28 @@
 package cmd
 
 import (
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/crazyfrankie/zdocker/container"
 )
 
 func NewInitCommand() *cobra.Command {
+	var reaper bool
+
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Init container process",
 		Long:  "Init container process run user's process in container . Do not call it outside",
+		// stderr belongs to the container, the error alone is printed there
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Infof("init come on")
-
-			return container.RunContainerInitProcess()
+			return container.RunContainerInitProcess(reaper)
 		},
 		DisableFlagsInUseLine: true,
 	}
 
+	cmd.Flags().BoolVarP(&reaper, "reaper", "", false, "run the user command under a minimal init that forwards signals and reaps zombies")
+
 	return cmd
 }
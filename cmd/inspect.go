@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/logger"
+)
+
+type inspectOptions struct {
+	format string
+}
+
+// containerInspect is the record of a container shown by inspect, --format templates refer to its fields.
+type containerInspect struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Image           string                 `json:"image"`
+	Created         string                 `json:"created"`
+	State           inspectState           `json:"state"`
+	Config          inspectConfig          `json:"config"`
+	HostConfig      inspectHostConfig      `json:"hostConfig"`
+	Mounts          []inspectMount         `json:"mounts"`
+	GraphDriver     inspectGraphDriver     `json:"graphDriver"`
+	NetworkSettings inspectNetworkSettings `json:"networkSettings"`
+	LogPath         string                 `json:"logPath"`
+}
+
+type inspectState struct {
+	Status          string            `json:"status"`
+	Running         bool              `json:"running"`
+	Restarting      bool              `json:"restarting"`
+	Pid             int               `json:"pid"`
+	ExitCode        int               `json:"exitCode"`
+	ExitSignal      string            `json:"exitSignal"`
+	FinishedAt      string            `json:"finishedAt"`
+	RestartCount    int               `json:"restartCount"`
+	ManuallyStopped bool              `json:"manuallyStopped"`
+	Health          *container.Health `json:"health"`
+}
+
+type inspectConfig struct {
+	Cmd         []string                `json:"cmd"`
+	Env         []string                `json:"env"`
+	Tty         bool                    `json:"tty"`
+	OpenStdin   bool                    `json:"openStdin"`
+	Labels      map[string]string       `json:"labels"`
+	Healthcheck *container.HealthConfig `json:"healthcheck"`
+}
+
+type inspectHostConfig struct {
+	Init          bool                    `json:"init"`
+	AutoRemove    bool                    `json:"autoRemove"`
+	RestartPolicy container.RestartPolicy `json:"restartPolicy"`
+	LogConfig     logger.Config           `json:"logConfig"`
+	CgroupPath    string                  `json:"cgroupPath"`
+	Resources     *cgroups.ResourceConfig `json:"resources"`
+	PortBindings  []string                `json:"portBindings"`
+}
+
+type inspectMount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type inspectGraphDriver struct {
+	Name      string `json:"name"`
+	LowerDir  string `json:"lowerDir"`
+	UpperDir  string `json:"upperDir"`
+	WorkDir   string `json:"workDir"`
+	MergedDir string `json:"mergedDir"`
+}
+
+type inspectNetworkSettings struct {
+	Network    string   `json:"network"`
+	EndpointID string   `json:"endpointID"`
+	IPAddress  string   `json:"ipAddress"`
+	Ports      []string `json:"ports"`
+}
+
+func NewInspectCommand() *cobra.Command {
+	var option inspectOptions
+
+	cmd := &cobra.Command{
+		Use:   "inspect [OPTIONS] [CONTAINER...]",
+		Short: "Display detailed information on containers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			return inspectContainers(args, option.format)
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&option.format, "format", "f", "", "format the output using the given Go template, e.g. '{{.State.Pid}}'")
+
+	return cmd
+}
+
+// inspectContainers prints the records of the containers as a JSON array,
+// or each through the template format.
+func inspectContainers(containerNames []string, format string) error {
+	records := make([]*containerInspect, 0, len(containerNames))
+	for _, containerName := range containerNames {
+		info, err := getContainerInfoByName(containerName)
+		if err != nil {
+			return fmt.Errorf("no such container: %s", containerName)
+		}
+		records = append(records, newContainerInspect(info))
+	}
+
+	if format == "" {
+		data, err := sonic.ConfigStd.MarshalIndent(records, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	tmpl, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := tmpl.Execute(os.Stdout, record); err != nil {
+			return fmt.Errorf("execute format error %v", err)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func newContainerInspect(info *container.ContainerInfo) *containerInspect {
+	pid, _ := strconv.Atoi(info.PID)
+	record := &containerInspect{
+		ID:      info.ID,
+		Name:    info.Name,
+		Image:   info.Image,
+		Created: info.CreateTime,
+		State: inspectState{
+			Status:          info.Status,
+			Running:         info.Status == container.RUNNING,
+			Restarting:      info.Status == container.RESTARTING,
+			Pid:             pid,
+			ExitCode:        info.ExitCode,
+			ExitSignal:      info.ExitSignal,
+			FinishedAt:      info.FinishTime,
+			RestartCount:    info.RestartCount,
+			ManuallyStopped: info.ManuallyStopped,
+			Health:          info.Health,
+		},
+		Config: inspectConfig{
+			Cmd:         strings.Split(info.Command, " "),
+			Env:         info.Env,
+			Tty:         info.TTY,
+			OpenStdin:   info.OpenStdin,
+			Labels:      info.Labels,
+			Healthcheck: info.Healthcheck,
+		},
+		HostConfig: inspectHostConfig{
+			Init:          info.Init,
+			AutoRemove:    info.AutoRemove,
+			RestartPolicy: info.RestartPolicy,
+			LogConfig:     info.LogConfig,
+			CgroupPath:    info.CgroupPath,
+			Resources:     info.Resource,
+			PortBindings:  info.PortMapping,
+		},
+		Mounts: []inspectMount{},
+		GraphDriver: inspectGraphDriver{
+			Name:      "overlay",
+			LowerDir:  fmt.Sprintf(container.OverlayLower, info.Image),
+			UpperDir:  fmt.Sprintf(container.WriteLayerUrl, info.Name),
+			WorkDir:   fmt.Sprintf(container.OverlayWork, info.Name),
+			MergedDir: fmt.Sprintf(container.MntUrl, info.Name),
+		},
+		NetworkSettings: inspectNetworkSettings{
+			Network:   info.Network,
+			IPAddress: info.IPAddress,
+			Ports:     info.PortMapping,
+		},
+		LogPath: fmt.Sprintf(container.DefaultLocation, info.Name) + container.ContainerLogFile,
+	}
+	if info.Network != "" {
+		record.NetworkSettings.EndpointID = fmt.Sprintf("%s-%s", info.ID, info.Network)
+	}
+	if source, destination, ok := strings.Cut(info.Volume, ":"); ok && source != "" && destination != "" {
+		record.Mounts = append(record.Mounts, inspectMount{
+			Type:        "bind",
+			Source:      source,
+			Destination: filepath.Join("/", destination),
+		})
+	}
+
+	return record
+}
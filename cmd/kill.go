@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+type killOptions struct {
+	signal string
+}
+
+func NewKillCommand() *cobra.Command {
+	var option killOptions
+
+	cmd := &cobra.Command{
+		Use:   "kill [OPTIONS] [CONTAINER]",
+		Short: "Send a signal to a running container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			return killContainer(args[0], option.signal)
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&option.signal, "signal", "s", "SIGKILL", "signal to send to the container, by name (e.g. SIGUSR1, HUP) or number")
+
+	return cmd
+}
+
+// killContainer sends signal to the container without waiting for it to exit.
+// Its shim records the exit, if there is one.
+func killContainer(containerName string, signal string) error {
+	sig, err := parseSignal(signal)
+	if err != nil {
+		return err
+	}
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	containerName = info.Name
+	if info.Status != container.RUNNING || info.PID == "" {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	pid, err := strconv.Atoi(info.PID)
+	if err != nil {
+		return fmt.Errorf("convert pid from string to int error %v", err)
+	}
+
+	if sig == syscall.SIGKILL {
+		// a killed container is not restarted, like a stopped one
+		if err := updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+			info.ManuallyStopped = true
+		}); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("send signal %s to container %s error %v", signal, containerName, err)
+	}
+	log.Infof("Sent %s to container %s", signal, containerName)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// parseLabels builds the labels of a container from the files given with --label-file
+// and the key=value pairs given with --label, which override those of the files.
+func parseLabels(labels []string, labelFiles []string) (map[string]string, error) {
+	var pairs []string
+	for _, fileName := range labelFiles {
+		lines, err := readKeyValueFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("read label file %s error %v", fileName, err)
+		}
+		pairs = append(pairs, lines...)
+	}
+	pairs = append(pairs, labels...)
+
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		// a label without a value is a plain tag
+		key, value, _ := strings.Cut(pair, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// readKeyValueFile reads a file of key=value lines, leaving out blank lines and # comments.
+func readKeyValueFile(fileName string) ([]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// formatLabels formats labels as comma separated key=value pairs ordered by key.
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
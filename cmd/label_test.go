@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"maps"
+	"os"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	dir := t.TempDir()
+	labelFile := dir + "/labels"
+	if err := os.WriteFile(labelFile, []byte("# owner of the container\napp=web\n\n   \ntier=front\n  # indented comment\nversion=1=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherFile := dir + "/other"
+	if err := os.WriteFile(otherFile, []byte("tier=back\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		labels     []string
+		labelFiles []string
+		want       map[string]string
+		wantErr    bool
+	}{
+		{want: map[string]string{}},
+		{labels: []string{"app=web", "debug"}, want: map[string]string{"app": "web", "debug": ""}},
+		{labelFiles: []string{labelFile}, want: map[string]string{"app": "web", "tier": "front", "version": "1=2"}},
+		// a later file overrides an earlier one, --label overrides the files
+		{labelFiles: []string{labelFile, otherFile}, want: map[string]string{"app": "web", "tier": "back", "version": "1=2"}},
+		{labels: []string{"app=api"}, labelFiles: []string{labelFile}, want: map[string]string{"app": "api", "tier": "front", "version": "1=2"}},
+		{labels: []string{"=web"}, wantErr: true},
+		{labelFiles: []string{dir + "/missing"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := parseLabels(c.labels, c.labelFiles)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("parseLabels(%q, %q) error %v", c.labels, c.labelFiles, err)
+		}
+		if err == nil && !maps.Equal(got, c.want) {
+			t.Fatalf("parseLabels(%q, %q) = %v, want %v", c.labels, c.labelFiles, got, c.want)
+		}
+	}
+}
@@ -3,10 +3,15 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 	"text/tabwriter"
+	"text/template"
 
 	"github.com/bytedance/sonic"
 	log "github.com/sirupsen/logrus"
@@ -15,27 +20,139 @@ import (
 	"github.com/crazyfrankie/zdocker/container"
 )
 
+type psOptions struct {
+	all     bool
+	quiet   bool
+	filters []string
+	format  string
+}
+
+// psRow is a container as listed by ps, --format templates refer to its fields.
+type psRow struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	PID      string `json:"pid"`
+	Status   string `json:"status"`
+	Command  string `json:"command"`
+	Created  string `json:"created"`
+	Ports    string `json:"ports"`
+	Networks string `json:"networks"`
+	Size     string `json:"size"`
+	ExitCode int    `json:"exitCode"`
+	Labels   string `json:"labels"`
+}
+
 func NewListCommand() *cobra.Command {
+	var option psOptions
+
 	cmd := &cobra.Command{
-		Use:   "ps",
-		Short: "List all the containers",
+		Use:   "ps [OPTIONS]",
+		Short: "List containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ListContainers()
-			return nil
+			return ListContainers(option)
 		},
 		DisableFlagsInUseLine: true,
 	}
 
+	flags := cmd.Flags()
+	flags.BoolVarP(&option.all, "all", "a", false, "show all containers (default shows just running)")
+	flags.BoolVarP(&option.quiet, "quiet", "q", false, "only display container IDs")
+	flags.StringArrayVarP(&option.filters, "filter", "f", []string{}, "filter output based on conditions provided (e.g., status=exit,name=web,label=key=value)")
+	flags.StringVar(&option.format, "format", "", "format the output using the given Go template, or 'json' to print each container as JSON")
+
 	return cmd
 }
 
-func ListContainers() {
+func ListContainers(option psOptions) error {
+	filter, err := parseContainerFilter(option.filters)
+	if err != nil {
+		return err
+	}
+	var tmpl *template.Template
+	if option.format != "" && option.format != "json" {
+		if tmpl, err = parseFormat(option.format); err != nil {
+			return err
+		}
+	}
+
+	containerInfos, err := listContainerInfos()
+	if err != nil {
+		return err
+	}
+	// a container with the status asked for is shown whether it runs or not
+	if !option.all && !filter.has("status") {
+		filter["status"] = []string{container.RUNNING, container.RESTARTING}
+	}
+	containerInfos = slices.DeleteFunc(containerInfos, func(info *container.ContainerInfo) bool {
+		return !filter.match(info)
+	})
+
+	switch {
+	case option.quiet:
+		for _, item := range containerInfos {
+			fmt.Println(item.ID)
+		}
+	case option.format == "json":
+		for _, item := range containerInfos {
+			data, err := sonic.Marshal(newPsRow(item))
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		}
+	case tmpl != nil:
+		for _, item := range containerInfos {
+			if err := tmpl.Execute(os.Stdout, newPsRow(item)); err != nil {
+				return fmt.Errorf("execute format error %v", err)
+			}
+			fmt.Println()
+		}
+	default:
+		// use tabwriter.NewWriter print container info on console
+		// tab writer used to print line up
+		w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+		// the information column output by the console
+		fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tEXIT CODE\tCOMMAND\tCREATED\tPORTS\tNETWORKS\tSIZE\n")
+		for _, item := range containerInfos {
+			row := newPsRow(item)
+			exitCode := ""
+			if item.Status == container.STOP || item.Status == container.EXIT {
+				exitCode = strconv.Itoa(row.ExitCode)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				row.ID,
+				row.Name,
+				row.PID,
+				row.Status,
+				exitCode,
+				row.Command,
+				row.Created,
+				row.Ports,
+				row.Networks,
+				row.Size,
+			)
+		}
+		// flush the standard output stream buffer to print out the list of containers
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("flush error %v", err)
+		}
+	}
+
+	return nil
+}
+
+// listContainerInfos reads the info of every container. The status of a container
+// recorded as running whose process is gone is updated to exit on the way.
+func listContainerInfos() ([]*container.ContainerInfo, error) {
 	dirUrl := fmt.Sprintf(container.DefaultLocation, "")
 	dirUrl = dirUrl[:len(dirUrl)-1]
 	files, err := os.ReadDir(dirUrl)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		log.Errorf("read dir %s error %v", dirUrl, err)
-		return
+		return nil, fmt.Errorf("read dir %s error %v", dirUrl, err)
 	}
 	containerInfos := make([]*container.ContainerInfo, 0, len(files))
 	for _, f := range files {
@@ -60,26 +177,72 @@ func ListContainers() {
 		containerInfos = append(containerInfos, info)
 	}
 
-	// use tabwriter.NewWriter print container info on console
-	// tab writer used to print line up
-	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	// the information column output by the console
-	fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\n")
-	for _, item := range containerInfos {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			item.ID,
-			item.Name,
-			item.PID,
-			item.Status,
-			item.Command,
-			item.CreateTime,
-		)
-	}
-	// flush the standard output stream buffer to print out the list of containers
-	if err := w.Flush(); err != nil {
-		log.Errorf("flush error %v.", err)
-		return
+	return containerInfos, nil
+}
+
+func newPsRow(info *container.ContainerInfo) *psRow {
+	ports := make([]string, 0, len(info.PortMapping))
+	for _, pm := range info.PortMapping {
+		if hostPort, containerPort, ok := strings.Cut(pm, ":"); ok {
+			ports = append(ports, fmt.Sprintf("%s->%s/tcp", hostPort, containerPort))
+		}
+	}
+
+	return &psRow{
+		ID:       info.ID,
+		Name:     info.Name,
+		Image:    info.Image,
+		PID:      info.PID,
+		Status:   containerStatus(info),
+		Command:  info.Command,
+		Created:  info.CreateTime,
+		Ports:    strings.Join(ports, ", "),
+		Networks: info.Network,
+		Size:     formatSize(dirSize(fmt.Sprintf(container.WriteLayerUrl, info.Name))),
+		ExitCode: info.ExitCode,
+		Labels:   formatLabels(info.Labels),
+	}
+}
+
+// dirSize is the size of the files under root, which is what the container wrote
+// when root is its writable layer.
+func dirSize(root string) int64 {
+	var size int64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// formatSize formats size in decimal units, like 1.5kB.
+func formatSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.3g%s", value, units[i])
+}
+
+// containerStatus is the status shown by ps, with the health of a running container.
+func containerStatus(info *container.ContainerInfo) string {
+	if info.Status == container.RUNNING && info.Health != nil {
+		return fmt.Sprintf("%s (%s)", info.Status, info.Health.Status)
 	}
+	return info.Status
 }
 
 func getContainerInfo(file os.DirEntry) (*container.ContainerInfo, error) {
@@ -129,33 +292,12 @@ func isProcessRunning(pidStr string) bool {
 
 // updateContainerStatusToExit updates container status to EXIT and clears PID
 func updateContainerStatusToExit(containerName string) error {
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
-	cfgFile := dirUrl + container.ConfigName
-
-	// Read current container info
-	content, err := os.ReadFile(cfgFile)
-	if err != nil {
-		return fmt.Errorf("read container config error: %v", err)
-	}
-
-	var info container.ContainerInfo
-	if err := sonic.Unmarshal(content, &info); err != nil {
-		return fmt.Errorf("unmarshal container info error: %v", err)
-	}
-
-	// Update status and clear PID
-	info.Status = container.EXIT
-	info.PID = ""
-
-	// Write back to file
-	newContent, err := sonic.Marshal(info)
-	if err != nil {
-		return fmt.Errorf("marshal container info error: %v", err)
-	}
-
-	if err := os.WriteFile(cfgFile, newContent, 0622); err != nil {
-		return fmt.Errorf("write container config error: %v", err)
-	}
-
-	return nil
+	return updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+		// the shim may have recorded the exit in the meantime
+		if info.Status != container.RUNNING {
+			return
+		}
+		info.Status = container.EXIT
+		info.PID = ""
+	})
 }
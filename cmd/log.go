@@ -3,47 +3,145 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"io"
 	"os"
+	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/logger"
 )
 
+type logsOptions struct {
+	timestamps bool
+	follow     bool
+	tail       string
+	since      string
+	until      string
+	stream     string
+}
+
 func NewLogCommand() *cobra.Command {
+	var option logsOptions
+
 	cmd := &cobra.Command{
-		Use:   "logs [CONTAINER]",
+		Use:   "logs [OPTIONS] [CONTAINER]",
 		Short: "Fetch the logs of a container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 0 {
+			if len(args) < 1 {
 				return errors.New("logs requires 1 argument")
 			}
+			config, err := newLogReadConfig(option, time.Now())
+			if err != nil {
+				return err
+			}
 			containerName := args[0]
-			ListContainerLogs(containerName)
+			ListContainerLogs(containerName, config, option.timestamps)
 			return nil
 		},
 		DisableFlagsInUseLine: true,
 	}
 
+	flags := cmd.Flags()
+	flags.BoolVarP(&option.timestamps, "timestamps", "t", false, "show timestamps")
+	flags.BoolVarP(&option.follow, "follow", "f", false, "follow log output until the container exits")
+	flags.StringVarP(&option.tail, "tail", "n", "all", "number of lines to show from the end of the logs")
+	flags.StringVarP(&option.since, "since", "", "", "show logs since timestamp (e.g. 2006-01-02T15:04:05Z) or relative (e.g. 42m)")
+	flags.StringVarP(&option.until, "until", "", "", "show logs before timestamp (e.g. 2006-01-02T15:04:05Z) or relative (e.g. 42m)")
+	flags.StringVarP(&option.stream, "stream", "", "", "only show the given stream (stdout or stderr)")
+
 	return cmd
 }
 
-func ListContainerLogs(containerName string) {
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
-	logFile := dirUrl + container.ContainerLogFile
-	file, err := os.Open(logFile)
-	defer file.Close()
+func newLogReadConfig(option logsOptions, now time.Time) (*logger.ReadConfig, error) {
+	config := &logger.ReadConfig{
+		Stream: option.stream,
+		Tail:   -1,
+		Follow: option.follow,
+	}
 
+	switch option.stream {
+	case "", logger.Stdout, logger.Stderr:
+	default:
+		return nil, fmt.Errorf("invalid stream %q (supported: stdout, stderr)", option.stream)
+	}
+
+	if option.tail != "all" {
+		n, err := strconv.Atoi(option.tail)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid tail %q", option.tail)
+		}
+		config.Tail = n
+	}
+
+	var err error
+	if option.since != "" {
+		if config.Since, err = parseLogTime(option.since, now); err != nil {
+			return nil, err
+		}
+	}
+	if option.until != "" {
+		if config.Until, err = parseLogTime(option.until, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// parseLogTime parses the value of --since and --until: a timestamp,
+// a unix time in seconds, or a duration before now.
+func parseLogTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func ListContainerLogs(containerName string, config *logger.ReadConfig, timestamps bool) {
+	info, err := getContainerInfoByName(containerName)
 	if err != nil {
-		log.Errorf("Log container open file %s error %v", logFile, err)
+		log.Errorf("get container info by name %s error %v", containerName, err)
 		return
 	}
-	content, err := io.ReadAll(file)
+	containerName = info.Name
+	if driver := info.LogConfig.Driver; driver != "" && driver != logger.JSONFileDriver {
+		log.Errorf("logs is not supported by the %s log driver of container %s", driver, containerName)
+		return
+	}
+
+	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
+	logFile := dirUrl + container.ContainerLogFile
+
+	config.Alive = func() bool {
+		info, err := getContainerInfoByName(containerName)
+		return err == nil && (info.Status == container.RUNNING || info.Status == container.RESTARTING)
+	}
+	err = logger.ReadJSONLog(logFile, config, func(msg *logger.Message) error {
+		// like the container wrote it, stderr goes to our stderr
+		out := os.Stdout
+		if msg.Stream == logger.Stderr {
+			out = os.Stderr
+		}
+		if timestamps {
+			_, err := fmt.Fprintf(out, "%s %s", msg.Time.Format(time.RFC3339Nano), msg.Log)
+			return err
+		}
+		_, err := fmt.Fprint(out, msg.Log)
+		return err
+	})
 	if err != nil {
 		log.Errorf("Log container read file %s error %v", logFile, err)
-		return
 	}
-	fmt.Fprint(os.Stdout, string(content))
 }
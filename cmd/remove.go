@@ -1,30 +1,43 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"os"
+	"path"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/crazyfrankie/zdocker/cgroups"
 	"github.com/crazyfrankie/zdocker/container"
 )
 
+type removeOptions struct {
+	filters []string
+}
+
 func NewRemoveCommand() *cobra.Command {
+	var option removeOptions
+
 	cmd := &cobra.Command{
-		Use:   "rm [CONTAINER]",
-		Short: "remove a container",
+		Use:   "rm [OPTIONS] [CONTAINER...]",
+		Short: "remove containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 1 {
-				return errors.New("missing container name")
+			containerNames, err := selectContainers(args, option.filters, nil)
+			if err != nil {
+				return err
+			}
+			for _, containerName := range containerNames {
+				removeContainer(containerName)
 			}
-			removeContainer(args[0])
 			return nil
 		},
 		DisableFlagsInUseLine: true,
 	}
 
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&option.filters, "filter", "", []string{}, "remove the containers matching the conditions provided (e.g., label=key=value)")
+
 	return cmd
 }
 
@@ -34,15 +47,31 @@ func removeContainer(containerName string) {
 		log.Errorf("get container info by name %s error %v.", containerName, err)
 		return
 	}
-	if info.Status == container.RUNNING {
+	if info.Status == container.RUNNING || info.Status == container.RESTARTING {
 		log.Errorf("cannot remove running container")
 		return
 	}
 
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
+	// the shim releases these when the container exits, unless it was killed itself
+	if info.IPAddress != "" {
+		releaseContainerNetwork(info)
+	}
+	cgroups.NewCgroupManager(path.Join("zdocker", info.ID)).Destroy()
+
+	if err := removeContainerFiles(info); err != nil {
+		log.Errorf("Remove container %s error %v", containerName, err)
+	}
+}
+
+// removeContainerFiles deletes the volume mounts, the writable layer and the state directory of the container.
+func removeContainerFiles(info *container.ContainerInfo) error {
+	container.DeleteWorkSpace(info.Name, info.Volume)
+
+	dirUrl := fmt.Sprintf(container.DefaultLocation, info.Name)
+	waitForWaiters(dirUrl)
 	if err := os.RemoveAll(dirUrl); err != nil {
-		log.Errorf("Remove file %s error %v", dirUrl, err)
-		return
+		return fmt.Errorf("remove dir %s error %v", dirUrl, err)
 	}
-	container.DeleteWorkSpace(containerName, info.Volume)
+
+	return nil
 }
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+type restartOptions struct {
+	timeout int
+}
+
+func NewRestartCommand() *cobra.Command {
+	var option restartOptions
+
+	cmd := &cobra.Command{
+		Use:   "restart [OPTIONS] [CONTAINER]",
+		Short: "Restart a container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			if err := restartContainer(args[0], option.timeout); err != nil {
+				return err
+			}
+			fmt.Println(args[0])
+
+			return nil
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	flags := cmd.Flags()
+	flags.IntVarP(&option.timeout, "timeout", "t", 0, "seconds to wait for the container to stop before killing it")
+
+	return cmd
+}
+
+// restartContainer stops the container like stop does if it is running, and starts it again.
+func restartContainer(containerName string, timeout int) error {
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	containerName = info.Name
+	if info.Status == container.RUNNING || info.Status == container.RESTARTING {
+		if err := stopContainer(containerName, timeout, "SIGTERM"); err != nil {
+			return err
+		}
+	}
+
+	return startExistingContainer(containerName)
+}
@@ -12,23 +12,58 @@ const usage = `zdocker is a simple container runtime implementation.
 			   The purpose of this project is to learn how docker works and how to write a docker by ourselves
 			   Enjoy it, just for fun.`
 
+var (
+	logLevel string
+	debug    bool
+)
+
 func init() {
 	addCommand()
 	log.SetFormatter(&log.JSONFormatter{})
-	log.SetOutput(os.Stdout)
+	// stdout belongs to the output of the commands and the containers
+	log.SetOutput(os.Stderr)
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVarP(&logLevel, "log-level", "l", "info", "set the logging level (debug, info, warn, error, fatal)")
+	flags.BoolVarP(&debug, "debug", "D", false, "enable debug output, same as --log-level debug")
+}
+
+// setUpLogging applies the global logging flags.
+func setUpLogging() error {
+	level, err := log.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q", logLevel)
+	}
+	if debug {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
+
+	return nil
 }
 
 func addCommand() {
 	rootCmd.AddCommand(
 		NewRunCommand(),
+		NewCreateCommand(),
+		NewStartCommand(),
 		NewInitCommand(),
 		NewCommitCommand(),
 		NewListCommand(),
+		NewInspectCommand(),
+		NewTopCommand(),
+		NewCopyCommand(),
 		NewLogCommand(),
 		NewExecCommand(),
+		NewExecListCommand(),
 		NewStopCommand(),
+		NewRestartCommand(),
+		NewKillCommand(),
+		NewWaitCommand(),
 		NewRemoveCommand(),
 		NewNetworkCommand(),
+		NewShimCommand(),
+		NewAttachCommand(),
 	)
 }
 
@@ -36,10 +71,14 @@ var rootCmd = &cobra.Command{
 	Use:   "zdocker",
 	Short: "simple container runtime implementation.",
 	Long:  usage,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setUpLogging()
+	},
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
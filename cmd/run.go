@@ -3,10 +3,13 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -15,7 +18,9 @@ import (
 
 	"github.com/crazyfrankie/zdocker/cgroups"
 	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/logger"
 	"github.com/crazyfrankie/zdocker/network"
+	"github.com/crazyfrankie/zdocker/term"
 )
 
 const (
@@ -25,14 +30,24 @@ const (
 type runOptions struct {
 	detach        bool
 	enableTTY     bool
+	interactive   bool
+	init          bool
+	autoRemove    bool
 	containerName string
 	volume        string
 	memoryLimit   string
 	cpuShareLimit string
 	cpuSetLimit   string
 	network       string
+	restart       string
+	health        container.HealthConfig
 	environments  []string
+	envFiles      []string
 	portMapping   []string
+	logDriver     string
+	logOptions    []string
+	labels        []string
+	labelFiles    []string
 }
 
 func NewRunCommand() *cobra.Command {
@@ -46,14 +61,14 @@ func NewRunCommand() *cobra.Command {
 			if len(args) < 1 {
 				return fmt.Errorf("missing container command")
 			}
-			if option.enableTTY && option.detach {
-				return errors.New("t and d parameter can not both provided")
+			info, err := newContainerInfo(option, args, option.detach)
+			if err != nil {
+				return err
 			}
-			Run(option, args, &cgroups.ResourceConfig{
-				MemoryLimit: option.memoryLimit,
-				CpuShare:    option.cpuShareLimit,
-				CpuSet:      option.cpuSetLimit,
-			})
+			if !info.RestartPolicy.IsNone() && option.enableTTY && !option.detach {
+				return errors.New("restart policy can only be used with a detached container")
+			}
+			Run(info, option.detach)
 
 			return nil
 		},
@@ -63,27 +78,76 @@ func NewRunCommand() *cobra.Command {
 	flags := cmd.Flags()
 	flags.SetInterspersed(false)
 	flags.BoolVarP(&option.detach, "detach", "d", false, "detach container")
+	addContainerFlags(cmd, &option)
+
+	return cmd
+}
+
+// addContainerFlags adds the flags describing a container, run and create share them.
+func addContainerFlags(cmd *cobra.Command, option *runOptions) {
+	flags := cmd.Flags()
 	flags.BoolVarP(&option.enableTTY, "ti", "t", false, "enable tty")
+	flags.BoolVarP(&option.interactive, "interactive", "i", false, "keep stdin open even if not attached")
+	flags.BoolVarP(&option.init, "init", "", false, "run an init inside the container that forwards signals and reaps processes")
+	flags.BoolVarP(&option.autoRemove, "rm", "", false, "automatically remove the container and its resources when it exits")
 	flags.StringVarP(&option.containerName, "name", "n", "", "container name")
 	flags.StringVarP(&option.volume, "volume", "v", "", "volume")
 	flags.StringVarP(&option.memoryLimit, "memory", "m", "", "memory limit")
 	flags.StringVarP(&option.cpuShareLimit, "cpushare", "", "", "cpushare limit")
 	flags.StringVarP(&option.cpuSetLimit, "cpuset", "", "", "cpuset limit")
 	flags.StringVarP(&option.network, "net", "", "", "container network")
+	flags.StringVarP(&option.restart, "restart", "", container.RestartNo, "restart policy to apply when the container exits (no, on-failure[:max-retries], always, unless-stopped)")
+	flags.StringVarP(&option.health.Cmd, "health-cmd", "", "", "command to run inside the container to check its health")
+	flags.DurationVarP(&option.health.Interval, "health-interval", "", 30*time.Second, "time between running the health check")
+	flags.DurationVarP(&option.health.Timeout, "health-timeout", "", 30*time.Second, "maximum time to allow one health check to run")
+	flags.IntVarP(&option.health.Retries, "health-retries", "", 3, "consecutive failures needed to report unhealthy")
+	flags.StringVarP(&option.health.OnFailure, "health-on-failure", "", container.HealthOnFailureNone, "action to take once the container becomes unhealthy (none, kill, stop)")
 	flags.StringArrayVarP(&option.portMapping, "port", "p", []string{}, "port mapping")
+	flags.StringVarP(&option.logDriver, "log-driver", "", logger.JSONFileDriver, "log driver for the container (json-file, syslog)")
+	flags.StringArrayVarP(&option.logOptions, "log-opt", "", []string{}, "log driver options (e.g., --log-opt max-size=10m --log-opt max-file=3 --log-opt compress=true, --log-opt syslog-address=udp://host:514)")
+	flags.StringArrayVarP(&option.labels, "label", "", []string{}, "set metadata on the container (e.g., --label key=value)")
+	flags.StringArrayVarP(&option.labelFiles, "label-file", "", []string{}, "read in a file of key=value labels, one per line")
 	flags.StringArrayVarP(&option.environments, "env", "e", []string{}, "container running env (e.g., -e KEY1=value1 -e KEY2=value2)")
-
-	return cmd
+	flags.StringArrayVarP(&option.envFiles, "env-file", "", []string{}, "read in a file of environment variables, one KEY=value per line")
 }
 
-func Run(options runOptions, args []string, res *cgroups.ResourceConfig) {
+// newContainerInfo checks the options and builds the info of a new container running args,
+// IMAGE [COMMAND] [ARG...]. detach tells whether the container runs in the background.
+func newContainerInfo(options runOptions, args []string, detach bool) (*container.ContainerInfo, error) {
+	restartPolicy, err := container.ParseRestartPolicy(options.restart)
+	if err != nil {
+		return nil, err
+	}
+	if !restartPolicy.IsNone() && options.autoRemove {
+		return nil, errors.New("conflicting options: --restart and --rm")
+	}
+	logConfig, err := parseLogConfig(options.logDriver, options.logOptions)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseLabels(options.labels, options.labelFiles)
+	if err != nil {
+		return nil, err
+	}
+	env, err := containerEnv(args[0], options.envFiles, options.environments, options.enableTTY)
+	if err != nil {
+		return nil, err
+	}
+	var healthcheck *container.HealthConfig
+	if options.health.Cmd != "" {
+		if err := options.health.Validate(); err != nil {
+			return nil, err
+		}
+		healthcheck = &options.health
+	}
+
 	// get image name
 	imageName := args[0]
 	commands := args[1:]
 
 	// Handle default commands like Docker does
 	if len(commands) == 0 {
-		commands = getDefaultCommand(imageName, options.detach)
+		commands = getDefaultCommand(imageName, detach)
 	}
 
 	containerID := randStringBytes(10)
@@ -91,52 +155,202 @@ func Run(options runOptions, args []string, res *cgroups.ResourceConfig) {
 		options.containerName = containerID
 	}
 
-	// build the parent process that created the container
-	parent, writePipe := container.NewParentProcess(imageName, options.containerName, options.volume, options.enableTTY, options.environments)
-	if parent == nil {
-		log.Errorf("New parent process error")
+	return &container.ContainerInfo{
+		ID:          containerID,
+		Name:        options.containerName,
+		Image:       imageName,
+		Command:     strings.Join(commands, " "),
+		Volume:      options.volume,
+		PortMapping: options.portMapping,
+		Network:     options.network,
+		Env:         env,
+		TTY:         options.enableTTY,
+		OpenStdin:   options.interactive,
+		Init:        options.init,
+		AutoRemove:  options.autoRemove,
+		Labels:      labels,
+		Resource: &cgroups.ResourceConfig{
+			MemoryLimit: options.memoryLimit,
+			CpuShare:    options.cpuShareLimit,
+			CpuSet:      options.cpuSetLimit,
+		},
+
+		RestartPolicy: restartPolicy,
+		Healthcheck:   healthcheck,
+		LogConfig:     logConfig,
+	}, nil
+}
+
+// containerEnv builds the environment of a container: the variables of the image config,
+// overridden by those of the --env-file files, overridden by those given with -e.
+func containerEnv(imageName string, envFiles []string, environments []string, tty bool) ([]string, error) {
+	imageConfig, err := container.ReadImageConfig(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("read config of image %s error %v", imageName, err)
+	}
+	env, err := overrideEnv(imageConfig.Env, envFiles, environments)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.DefaultEnv(env, tty), nil
+}
+
+// overrideEnv sets over env the variables of the --env-file files, in order, then those given with -e.
+func overrideEnv(env []string, envFiles []string, environments []string) ([]string, error) {
+	var overrides []string
+	for _, fileName := range envFiles {
+		lines, err := readKeyValueFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("read env file %s error %v", fileName, err)
+		}
+		overrides = append(overrides, lines...)
+	}
+	overrides = append(overrides, environments...)
+
+	return mergeEnv(env, overrides), nil
+}
+
+// Run creates the container described by info and starts it, in the foreground
+// with its terminal unless it is detached or has no tty.
+func Run(info *container.ContainerInfo, detach bool) {
+	if err := createContainer(info); err != nil {
+		log.Errorf("Create container %s error %v", info.Name, err)
 		return
 	}
-	if err := parent.Start(); err != nil {
-		log.Error(err)
+	startFailed := func(err error) {
+		log.Errorf("Start container %s error %v", info.Name, err)
+		if info.AutoRemove {
+			removeContainer(info.Name)
+		}
 	}
 
-	// record container info
-	if err := recordContainerInfo(parent.Process.Pid, containerID, options.containerName, options.volume, options.portMapping, commands); err != nil {
-		log.Errorf("record container info error %v.", err)
+	if detach || !info.TTY {
+		// the shim holds the stdio of the container after we return
+		if err := startShim(info); err != nil {
+			startFailed(err)
+			return
+		}
+		log.Infof("Container %s is running in detach mode", info.Name)
 		return
 	}
 
-	cgroupManager := cgroups.NewCgroupManager("zdocker")
+	cgroupManager := cgroups.NewCgroupManager(path.Join("zdocker", info.ID))
 	defer cgroupManager.Destroy()
 
-	cgroupManager.Set(res)
-	cgroupManager.Apply(parent.Process.Pid)
+	parent, err := startContainer(info, cgroupManager)
+	if err != nil {
+		releaseContainerNetwork(info)
+		startFailed(err)
+		return
+	}
+	defer parent.IO.Pty.Master.Close()
 
-	if options.network != "" {
-		// config container network
-		network.InitNetwork()
-		containerInfo := &container.ContainerInfo{
-			ID:          containerID,
-			PID:         strconv.Itoa(parent.Process.Pid),
-			Name:        options.containerName,
-			PortMapping: options.portMapping,
+	// the terminal session is logged like the output of a detached container
+	var output io.Writer = os.Stdout
+	closeLog := func() {}
+	logDriver, err := logger.New(info.LogConfig, logger.Info{
+		ContainerID:   info.ID,
+		ContainerName: info.Name,
+		LogPath:       fmt.Sprintf(container.DefaultLocation, info.Name) + container.ContainerLogFile,
+	})
+	if err != nil {
+		log.Errorf("Create log driver of container %s error %v", info.Name, err)
+	} else {
+		// a failing log driver must not cut the terminal off the container
+		logWriter := logger.NewWriter(logger.IgnoreErrors(logDriver), logger.Stdout)
+		output = io.MultiWriter(os.Stdout, logWriter)
+		closeLog = func() {
+			logWriter.Close()
+			logDriver.Close()
 		}
-		if err := network.Connect(options.network, containerInfo); err != nil {
-			log.Errorf("Error Connect Network %v", err)
-			return
+	}
+
+	restore := term.Relay(parent.IO.Pty, os.Stdin, output)
+	stopHealth := monitorHealth(info)
+	waitContainer(parent, info)
+	stopHealth()
+	restore()
+	closeLog()
+	releaseContainerNetwork(info)
+	if info.AutoRemove {
+		if err := removeContainerFiles(info); err != nil {
+			log.Errorf("Remove container %s error %v", info.Name, err)
 		}
 	}
+}
 
-	sendInitCommand(commands, writePipe)
-	if options.enableTTY {
+// parseLogConfig builds the log config from the driver and the key=value pairs given with --log-opt.
+func parseLogConfig(driver string, logOptions []string) (logger.Config, error) {
+	config := logger.Config{Driver: driver, Options: map[string]string{}}
+	for _, opt := range logOptions {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok || key == "" {
+			return logger.Config{}, fmt.Errorf("invalid log opt %q, expected key=value", opt)
+		}
+		config.Options[key] = value
+	}
+
+	return config, logger.ValidateConfig(config)
+}
+
+// startContainer creates the container process described by info, applies the cgroup limits,
+// connects the network and records it before letting the user command run.
+// The caller owns the returned process and the host side of its stdio. When it fails,
+// the network is left to the caller, which releases it once if it gives up on the container.
+func startContainer(info *container.ContainerInfo, cgroupManager *cgroups.CgroupManager) (*container.ParentProcess, error) {
+	// build the parent process that created the container
+	parent := container.NewParentProcess(info.Image, info.Name, info.Volume, info.TTY, info.OpenStdin, info.Init, info.Env)
+	if parent == nil {
+		return nil, errors.New("new parent process error")
+	}
+	if err := parent.Start(); err != nil {
+		return nil, err
+	}
+
+	// the container init exits as soon as it reads an empty command
+	abort := func(err error) (*container.ParentProcess, error) {
+		parent.InitPipe.Close()
+		parent.Process.Kill()
 		parent.Wait()
-		deleteContainerInfo(options.containerName)
-		container.DeleteWorkSpace(options.containerName, options.volume)
-	} else {
-		// For detach mode, we don't wait for the container to finish
-		log.Infof("Container %s is running in detach mode with PID %d", options.containerName, parent.Process.Pid)
+		return nil, err
+	}
+
+	pid, err := parent.ContainerPID()
+	if err != nil {
+		return abort(err)
+	}
+	info.PID = strconv.Itoa(pid)
+	info.CgroupPath = cgroupManager.Path
+	if info.Healthcheck != nil {
+		// every run of the container starts over with no result
+		info.Health = &container.Health{Status: container.HealthStarting}
+	}
+
+	if info.Resource != nil {
+		cgroupManager.Set(info.Resource)
+	}
+	cgroupManager.Apply(pid)
+
+	if info.Network != "" {
+		// config container network
+		network.InitNetwork()
+		if err := network.Connect(info.Network, info); err != nil {
+			return abort(fmt.Errorf("connect network error %v", err))
+		}
+	}
+
+	// record container info
+	if err := recordContainerInfo(info); err != nil {
+		if errors.Is(err, errStoppedWhileStarting) {
+			return abort(err)
+		}
+		return abort(fmt.Errorf("record container info error %v", err))
 	}
+
+	sendInitCommand(strings.Split(info.Command, " "), parent.InitPipe)
+
+	return parent, nil
 }
 
 // getDefaultCommand returns default commands for different images like Docker does
@@ -167,54 +381,81 @@ func sendInitCommand(commands []string, writePipe *os.File) {
 	writePipe.Close()
 }
 
-func recordContainerInfo(pid int, containerId string, containerName string, volume string, portMapping []string, commands []string) error {
-	createTime := time.Now().Format(time.DateTime)
-	command := strings.Join(commands, " ")
-	// if user not pick container name, then use cid as container name
-	containerInfo := &container.ContainerInfo{
-		PID:         strconv.Itoa(pid),
-		ID:          containerId,
-		Name:        containerName,
-		Command:     command,
-		CreateTime:  createTime,
-		Status:      container.RUNNING,
-		Volume:      volume,
-		PortMapping: portMapping,
+// errStoppedWhileStarting tells that the container was stopped before it was recorded as running.
+var errStoppedWhileStarting = errors.New("container was stopped while starting")
+
+// recordContainerInfo records the container as running. It is done under the lock of updateContainerInfo
+// so that a stop landing while the container starts is not overwritten, the start fails instead.
+func recordContainerInfo(containerInfo *container.ContainerInfo) error {
+	// a restarted container keeps the time it was created
+	if containerInfo.CreateTime == "" {
+		containerInfo.CreateTime = time.Now().Format(time.DateTime)
 	}
+
+	stopped := false
+	err := updateContainerInfo(containerInfo.Name, func(latest *container.ContainerInfo) {
+		if latest.ManuallyStopped {
+			stopped = true
+			return
+		}
+		containerInfo.Status = container.RUNNING
+		*latest = *containerInfo
+	})
+	if err != nil {
+		return err
+	}
+	if stopped {
+		return errStoppedWhileStarting
+	}
+	return nil
+}
+
+// writeContainerInfo saves the container info to its config.json.
+// The file is replaced by a rename so that readers never see a partial write.
+func writeContainerInfo(containerInfo *container.ContainerInfo) error {
 	data, err := sonic.Marshal(containerInfo)
 	if err != nil {
 		log.Errorf("record container info error %v", err)
 		return err
 	}
-	json := string(data)
 	// container info path
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
+	dirUrl := fmt.Sprintf(container.DefaultLocation, containerInfo.Name)
 	if err := os.MkdirAll(dirUrl, 0622); err != nil {
 		log.Errorf("mkdir error %s error %v.", dirUrl, err)
 		return err
 	}
-	fileName := dirUrl + "/" + container.ConfigName
-	// create config.json
-	file, err := os.Create(fileName)
-	if err != nil {
-		log.Errorf("create file %s error %v.", fileName, err)
+	fileName := dirUrl + container.ConfigName
+	tmpName := fileName + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0622); err != nil {
+		log.Errorf("write file %s error %v.", tmpName, err)
 		return err
 	}
-	defer file.Close()
 
-	if _, err := file.WriteString(json); err != nil {
-		log.Errorf("file write string error %v", err)
+	return os.Rename(tmpName, fileName)
+}
+
+// updateContainerInfo applies fn to the container info saved on disk.
+// The shim and the commands acting on a container update the same config.json,
+// so the read-modify-write is serialized by a flock on the container directory.
+func updateContainerInfo(containerName string, fn func(info *container.ContainerInfo)) error {
+	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
+	dir, err := os.Open(dirUrl)
+	if err != nil {
 		return err
 	}
+	defer dir.Close()
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s error %v", dirUrl, err)
+	}
+	defer syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
 
-	return nil
-}
-
-func deleteContainerInfo(containerName string) {
-	dirUrl := container.DefaultLocation + "/" + containerName
-	if err := os.RemoveAll(dirUrl); err != nil {
-		log.Errorf("remove dir %s error %v.", dirUrl, err)
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
 	}
+	fn(info)
+
+	return writeContainerInfo(info)
 }
 
 func randStringBytes(n int) string {
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestOverrideEnv(t *testing.T) {
+	dir := t.TempDir()
+	envFile := dir + "/env"
+	if err := os.WriteFile(envFile, []byte("# settings of the app\nMODE=file\n\nLEVEL=debug\nURL=http://host/?a=b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherFile := dir + "/other"
+	if err := os.WriteFile(otherFile, []byte("LEVEL=info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ZDOCKER_TEST_FROM_CALLER", "caller")
+	// set first so that the variable of the caller, if any, is restored after the test
+	t.Setenv("ZDOCKER_TEST_UNSET", "")
+	if err := os.Unsetenv("ZDOCKER_TEST_UNSET"); err != nil {
+		t.Fatal(err)
+	}
+
+	image := []string{"PATH=/usr/bin:/bin", "MODE=image", "HOME=/root"}
+	cases := []struct {
+		envFiles     []string
+		environments []string
+		want         []string
+		wantErr      bool
+	}{
+		{want: image},
+		// the image, then the files in order, then -e
+		{envFiles: []string{envFile}, want: []string{"PATH=/usr/bin:/bin", "MODE=file", "HOME=/root", "LEVEL=debug", "URL=http://host/?a=b"}},
+		{envFiles: []string{envFile, otherFile}, want: []string{"PATH=/usr/bin:/bin", "MODE=file", "HOME=/root", "LEVEL=info", "URL=http://host/?a=b"}},
+		{envFiles: []string{envFile}, environments: []string{"MODE=flag", "HOME="}, want: []string{"PATH=/usr/bin:/bin", "MODE=flag", "HOME=", "LEVEL=debug", "URL=http://host/?a=b"}},
+		// -e KEY takes the value of the caller, and sets nothing when the caller has none
+		{environments: []string{"ZDOCKER_TEST_FROM_CALLER", "ZDOCKER_TEST_UNSET"}, want: []string{"PATH=/usr/bin:/bin", "MODE=image", "HOME=/root", "ZDOCKER_TEST_FROM_CALLER=caller"}},
+		{envFiles: []string{dir + "/missing"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := overrideEnv(image, c.envFiles, c.environments)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("overrideEnv(%q, %q) error %v", c.envFiles, c.environments, err)
+		}
+		if err == nil && !slices.Equal(got, c.want) {
+			t.Fatalf("overrideEnv(%q, %q) = %q, want %q", c.envFiles, c.environments, got, c.want)
+		}
+	}
+}
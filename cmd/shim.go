@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/logger"
+	"github.com/crazyfrankie/zdocker/network"
+	"github.com/crazyfrankie/zdocker/shim"
+)
+
+const (
+	restartBackoffMin   = 100 * time.Millisecond
+	restartBackoffMax   = time.Minute
+	restartBackoffReset = 10 * time.Second
+)
+
+func NewShimCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "shim",
+		Short:  "Monitor a detached container",
+		Long:   "Monitor a detached container: hold its stdio, serve attach requests and record how it exits. Do not call it outside",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runShim()
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	return cmd
+}
+
+// startShim starts a shim in its own session for the container described by info,
+// and blocks until the shim reports whether the container has been started.
+//
+// The container info is sent over the shim's stdin, the shim reports back through
+// the pipe on its fd 3: closing it without writing means the container is running,
+// anything written is the error.
+func startShim(info *container.ContainerInfo) error {
+	data, err := sonic.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	specRead, specWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("/proc/self/exe", "shim", "--log-level", log.GetLevel().String())
+	cmd.Stdin = specRead
+	cmd.ExtraFiles = []*os.File{readyWrite}
+	// the shim must outlive this process and the user's terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start shim error %v", err)
+	}
+	specRead.Close()
+	readyWrite.Close()
+
+	if _, err := specWrite.Write(data); err != nil {
+		return fmt.Errorf("send container info to shim error %v", err)
+	}
+	specWrite.Close()
+
+	msg, err := io.ReadAll(readyRead)
+	readyRead.Close()
+	if err != nil {
+		return fmt.Errorf("read shim ready pipe error %v", err)
+	}
+	if len(msg) > 0 {
+		return errors.New(string(msg))
+	}
+
+	// the shim is not waited on, it is reparented once we exit
+	return cmd.Process.Release()
+}
+
+func runShim() error {
+	ready := os.NewFile(uintptr(3), "ready")
+	reportErr := func(err error) error {
+		ready.WriteString(err.Error())
+		ready.Close()
+		return err
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return reportErr(fmt.Errorf("read container info error %v", err))
+	}
+	var info container.ContainerInfo
+	if err := sonic.Unmarshal(data, &info); err != nil {
+		return reportErr(fmt.Errorf("unmarshal container info error %v", err))
+	}
+
+	dirUrl := fmt.Sprintf(container.DefaultLocation, info.Name)
+	if err := os.MkdirAll(dirUrl, 0622); err != nil {
+		return reportErr(fmt.Errorf("mkdir %s error %v", dirUrl, err))
+	}
+	// the shim has no terminal, its diagnostics go next to those of the container init
+	runtimeLog, err := os.OpenFile(dirUrl+container.RuntimeLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return reportErr(fmt.Errorf("open runtime log error %v", err))
+	}
+	defer runtimeLog.Close()
+	log.SetOutput(runtimeLog)
+	if info.AutoRemove {
+		// deferred first so that it runs once the cgroup, the socket and the log are released
+		defer func() {
+			if err := removeContainerFiles(&info); err != nil {
+				log.Errorf("remove container %s error %v", info.Name, err)
+			}
+		}()
+	}
+	logDriver, err := logger.New(info.LogConfig, logger.Info{
+		ContainerID:   info.ID,
+		ContainerName: info.Name,
+		LogPath:       dirUrl + container.ContainerLogFile,
+	})
+	if err != nil {
+		return reportErr(err)
+	}
+	defer logDriver.Close()
+
+	cgroupManager := cgroups.NewCgroupManager(path.Join("zdocker", info.ID))
+	defer cgroupManager.Destroy()
+
+	// the attach socket outlives restarts of the container, only the stdio behind it changes
+	server, err := shim.NewAttachServer(dirUrl + container.AttachSocket)
+	if err != nil {
+		// the container can still run, it just can not be attached
+		log.Errorf("new attach server error %v", err)
+	} else {
+		go server.Serve()
+		defer func() {
+			server.Close()
+			os.Remove(dirUrl + container.AttachSocket)
+		}()
+	}
+
+	info.MonitorPID = os.Getpid()
+	parent, err := startContainer(&info, cgroupManager)
+	if err != nil {
+		releaseContainerNetwork(&info)
+		return reportErr(err)
+	}
+	ready.Close()
+
+	backoff := restartBackoffMin
+	for {
+		startedAt := time.Now()
+		stopHealth := monitorHealth(&info)
+		copyContainerOutput(parent, &info, logDriver, server)
+		restart := waitContainer(parent, &info)
+		stopHealth()
+		if !restart {
+			break
+		}
+
+		// a container that ran for a while is not crash looping, start over with the shortest delay
+		if time.Since(startedAt) >= restartBackoffReset {
+			backoff = restartBackoffMin
+		}
+		log.Infof("Restart container %s in %v", info.Name, backoff)
+		latest, err := waitRestart(info.Name, backoff)
+		if err != nil {
+			log.Errorf("restart container %s error %v", info.Name, err)
+			break
+		}
+		if latest == nil {
+			// stopped while waiting to be restarted
+			break
+		}
+		backoff = min(backoff*2, restartBackoffMax)
+
+		info = *latest
+		parent, err = startContainer(&info, cgroupManager)
+		if errors.Is(err, errStoppedWhileStarting) {
+			break
+		}
+		if err != nil {
+			log.Errorf("restart container %s error %v", info.Name, err)
+			updateContainerInfo(info.Name, func(info *container.ContainerInfo) {
+				info.Status = container.EXIT
+			})
+			break
+		}
+	}
+
+	releaseContainerNetwork(&info)
+
+	return nil
+}
+
+// copyContainerOutput sends the output of the container to the log driver and the attached clients
+// until every process of the container is gone, attach clients send their input to the container meanwhile.
+func copyContainerOutput(parent *container.ParentProcess, info *container.ContainerInfo, logDriver logger.Logger, server *shim.AttachServer) {
+	cio := parent.IO
+
+	// in tty mode the pty master carries both directions
+	var stdin io.Writer
+	output := cio.Stdout
+	if cio.Pty != nil {
+		output = cio.Pty.Master
+		if info.OpenStdin {
+			stdin = cio.Pty.Master
+		}
+	} else if cio.Stdin != nil {
+		stdin = cio.Stdin
+	}
+
+	var mirror io.Writer
+	if server != nil {
+		server.SetIO(stdin, cio.Pty)
+		defer server.SetIO(nil, nil)
+		mirror = server
+	}
+
+	var wg sync.WaitGroup
+	if cio.Stderr != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := logger.Copy(logDriver, logger.Stderr, cio.Stderr, mirror); err != nil {
+				log.Errorf("log stderr of container %s error %v", info.Name, err)
+			}
+			cio.Stderr.Close()
+		}()
+	}
+	if err := logger.Copy(logDriver, logger.Stdout, output, mirror); err != nil && !errors.Is(err, syscall.EIO) {
+		// reading the pty master fails with EIO once the container is gone, that is its EOF
+		log.Errorf("log stdout of container %s error %v", info.Name, err)
+	}
+	wg.Wait()
+
+	output.Close()
+	if cio.Stdin != nil {
+		cio.Stdin.Close()
+	}
+}
+
+// waitContainer reaps the container, records how it exited and tells whether it is restarted.
+func waitContainer(parent *container.ParentProcess, info *container.ContainerInfo) bool {
+	// the error only tells that the container did not exit with 0, which the wait status has as well
+	parent.Wait()
+	exitCode, exitSignal := exitStatus(parent.ProcessState)
+	log.Infof("Container %s exited with code %d", info.Name, exitCode)
+
+	restart, err := recordContainerExit(info.Name, exitCode, exitSignal)
+	if err != nil {
+		log.Errorf("record container %s exit error %v", info.Name, err)
+	}
+
+	return restart
+}
+
+// releaseContainerNetwork gives back the address and port mappings of a container that is not restarted.
+func releaseContainerNetwork(info *container.ContainerInfo) {
+	if info.Network == "" {
+		return
+	}
+	network.InitNetwork()
+	if err := network.Disconnect(info.Network, info); err != nil {
+		log.Errorf("disconnect container %s from network %s error %v", info.Name, info.Network, err)
+		return
+	}
+
+	// the address may be handed out again, it must not be released twice
+	info.IPAddress = ""
+	if err := updateContainerInfo(info.Name, func(info *container.ContainerInfo) {
+		info.IPAddress = ""
+	}); err != nil {
+		log.Errorf("record container %s network release error %v", info.Name, err)
+	}
+}
+
+// waitRestart waits backoff before the container is restarted, and then claims the restart:
+// the container info to start it with is returned if it is still waiting to be restarted, nil if it
+// was stopped meanwhile. A stop is noticed while waiting, so that stop does not wait for the backoff.
+func waitRestart(containerName string, backoff time.Duration) (*container.ContainerInfo, error) {
+	waiting := func(info *container.ContainerInfo) bool {
+		return info.Status == container.RESTARTING && !info.ManuallyStopped
+	}
+
+	deadline := time.Now().Add(backoff)
+	for time.Now().Before(deadline) {
+		time.Sleep(min(restartBackoffMin, time.Until(deadline)))
+		info, err := getContainerInfoByName(containerName)
+		if err != nil {
+			return nil, err
+		}
+		if !waiting(info) {
+			return nil, nil
+		}
+	}
+
+	var claimed *container.ContainerInfo
+	err := updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+		if waiting(info) {
+			latest := *info
+			claimed = &latest
+		}
+	})
+
+	return claimed, err
+}
+
+// exitStatus converts the wait status of the container into an exit code,
+// a container killed by a signal exits with 128 + signal like it does in a shell.
+func exitStatus(state *os.ProcessState) (int, string) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return state.ExitCode(), ""
+	}
+	if status.Signaled() {
+		return 128 + int(status.Signal()), unix.SignalName(status.Signal())
+	}
+
+	return status.ExitStatus(), ""
+}
+
+// recordContainerExit saves the exit information of the container, and decides from the restart policy
+// whether it is restarted: it is then marked as restarting in the same update, so that nobody sees it exited
+// in between. A container stopped by `zdocker stop` gets the stop status and is never restarted.
+func recordContainerExit(containerName string, exitCode int, exitSignal string) (bool, error) {
+	restart := false
+	err := updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+		switch {
+		case info.ManuallyStopped:
+			info.Status = container.STOP
+		case info.RestartPolicy.ShouldRestart(exitCode, info.RestartCount):
+			restart = true
+			info.Status = container.RESTARTING
+			info.RestartCount++
+		default:
+			info.Status = container.EXIT
+		}
+		info.PID = ""
+		info.ExitCode = exitCode
+		info.ExitSignal = exitSignal
+		info.FinishTime = time.Now().Format(time.DateTime)
+	})
+
+	return restart, err
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+func NewStartCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "start [CONTAINER]",
+		Short: "Start a created or stopped container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			if err := startExistingContainer(args[0]); err != nil {
+				return err
+			}
+			fmt.Println(args[0])
+
+			return nil
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	return cmd
+}
+
+// startExistingContainer starts a container that is not running in the background.
+// A container that ran before starts over on the writable layer it left.
+func startExistingContainer(containerName string) error {
+	// the state of the container is kept under its name, not its ID
+	if info, err := getContainerInfoByName(containerName); err == nil {
+		containerName = info.Name
+	}
+
+	var info *container.ContainerInfo
+	var running bool
+	err := updateContainerInfo(containerName, func(latest *container.ContainerInfo) {
+		if latest.Status == container.RUNNING || latest.Status == container.RESTARTING {
+			running = true
+			return
+		}
+		// the restart policy applies again
+		latest.ManuallyStopped = false
+		info = latest
+	})
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	if running {
+		return fmt.Errorf("container %s is already running", containerName)
+	}
+
+	if err := startShim(info); err != nil {
+		return fmt.Errorf("start container %s error %v", containerName, err)
+	}
+
+	return nil
+}
@@ -12,26 +12,45 @@ import (
 	"github.com/bytedance/sonic"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 
 	"github.com/crazyfrankie/zdocker/container"
 )
 
+const (
+	// the real-time signals as numbered by the C library, which keeps the first two for itself
+	sigRTMin = 34
+	sigRTMax = 64
+
+	// monitorExitTimeout is how long the shim of a stopped container gets to clean up
+	monitorExitTimeout = 10 * time.Second
+)
+
 type stopOptions struct {
 	signal  string
 	timeout int
+	filters []string
 }
 
 func NewStopCommand() *cobra.Command {
 	var option stopOptions
 
 	cmd := &cobra.Command{
-		Use:   "stop [OPTIONS] [CONTAINER]",
-		Short: "stop a running container",
+		Use:   "stop [OPTIONS] [CONTAINER...]",
+		Short: "stop running containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 1 {
-				return errors.New("missing container name")
+			// of the containers matching the filter, only those running can be stopped
+			containerNames, err := selectContainers(args, option.filters, isStoppable)
+			if err != nil {
+				return err
+			}
+			var errs []error
+			for _, containerName := range containerNames {
+				if err := stopContainer(containerName, option.timeout, option.signal); err != nil {
+					errs = append(errs, err)
+				}
 			}
-			return stopContainer(args[0], option.timeout, option.signal)
+			return errors.Join(errs...)
 		},
 		DisableFlagsInUseLine: true,
 	}
@@ -39,22 +58,62 @@ func NewStopCommand() *cobra.Command {
 	flags := cmd.Flags()
 	flags.IntVarP(&option.timeout, "timeout", "t", 0, "seconds to wait before killing the container")
 	flags.StringVarP(&option.signal, "signal", "s", "SIGTERM", "signal to send to the container")
+	flags.StringArrayVarP(&option.filters, "filter", "", []string{}, "stop the containers matching the conditions provided (e.g., label=key=value)")
 
 	return cmd
 }
 
+// isStoppable tells whether the container has a process to stop or a restart to cancel.
+func isStoppable(info *container.ContainerInfo) bool {
+	return info.Status == container.RUNNING || info.Status == container.RESTARTING
+}
+
 func stopContainer(containerName string, timeout int, signal string) error {
 	// get container info first to check status
 	info, err := getContainerInfoByName(containerName)
 	if err != nil {
 		return fmt.Errorf("get container info by name %s error %v", containerName, err)
 	}
+	containerName = info.Name
 
 	// check if container is already stopped
 	if info.Status == container.STOP {
 		log.Infof("Container %s is already stopped", containerName)
 		return nil
 	}
+	if info.Status == container.CREATED {
+		log.Infof("Container %s has not been started", containerName)
+		return nil
+	}
+
+	// parse signal
+	sig, err := parseSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	// tell the shim not to restart the container before it exits. The status is read again
+	// under the lock: the shim claims a restart under the same lock, so either the restart
+	// happens before and there is a process to signal, or it does not happen at all.
+	restarting := false
+	if err := updateContainerInfo(containerName, func(latest *container.ContainerInfo) {
+		latest.ManuallyStopped = true
+		if latest.Status == container.RESTARTING {
+			restarting = true
+			latest.Status = container.STOP
+			latest.PID = ""
+		}
+		*info = *latest
+	}); err != nil {
+		return err
+	}
+	if restarting {
+		// the shim is waiting to restart it, there is no process to signal.
+		// It gives up once it sees the stop, and must be gone before the container is started again.
+		log.Infof("Container %s will not be restarted", containerName)
+		waitForMonitorExit(info.MonitorPID)
+		return nil
+	}
 
 	if info.PID == "" {
 		return fmt.Errorf("container %s has no PID information", containerName)
@@ -65,11 +124,7 @@ func stopContainer(containerName string, timeout int, signal string) error {
 		return fmt.Errorf("convert pid from string to int error %v", err)
 	}
 
-	// parse signal
-	sig, err := parseSignal(signal)
-	if err != nil {
-		return err
-	}
+	monitor := containerMonitorPID(pidInt)
 
 	// kill container process
 	if err := syscall.Kill(pidInt, sig); err != nil {
@@ -77,17 +132,82 @@ func stopContainer(containerName string, timeout int, signal string) error {
 	}
 	if sig == syscall.SIGKILL {
 		log.Infof("Sent SIGKILL to container %s (immediate termination)", containerName)
-		return updateContainerStatus(containerName)
+		if err := updateContainerStatus(containerName); err != nil {
+			return err
+		}
+	} else {
+		log.Infof("Sent %s to container %s, waiting up to %d seconds...", signal, containerName, timeout)
+		if err := waitForContainerStop(pidInt, containerName, timeout); err != nil {
+			return err
+		}
 	}
 
-	log.Infof("Sent %s to container %s, waiting up to %d seconds...", signal, containerName, timeout)
-	return waitForContainerStop(pidInt, containerName, timeout)
+	// the container is gone, but its shim may still be releasing the network and the cgroup,
+	// which must be done before the container can be started again
+	waitForMonitorExit(monitor)
+	return nil
+}
+
+// containerMonitorPID returns the pid of the process monitoring the container init pid,
+// the shim or a foreground run, 0 if there is none. The init is a child of the intermediate
+// process of the nsenter constructor, which is a child of the monitor.
+func containerMonitorPID(pid int) int {
+	intermediate := parentPID(pid)
+	if intermediate <= 1 {
+		return 0
+	}
+	monitor := parentPID(intermediate)
+	if monitor <= 1 {
+		return 0
+	}
+	return monitor
+}
+
+// parentPID returns the pid of the parent of the process pid, 0 if it is unknown.
+func parentPID(pid int) int {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// the command name in parentheses may contain spaces, the fields after it do not:
+	// pid (comm) state ppid ...
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
 }
 
+// waitForMonitorExit waits a bounded time for the monitor of a stopped container to exit.
+func waitForMonitorExit(pid int) {
+	// the shim stops its own container when it is unhealthy
+	if pid == 0 || pid == os.Getpid() {
+		return
+	}
+	deadline := time.Now().Add(monitorExitTimeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Warnf("monitor %d of the container did not exit after %v", pid, monitorExitTimeout)
+}
+
+// getContainerInfoByName reads the info of the container named containerName, or else of the container
+// with that ID, so that the IDs printed by ps -q are accepted wherever a name is. The state of the container
+// is kept under its name, the caller goes on with info.Name.
 func getContainerInfoByName(containerName string) (*container.ContainerInfo, error) {
 	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
 	cfgFile := dirUrl + container.ConfigName
 	content, err := os.ReadFile(cfgFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if info := getContainerInfoByID(containerName); info != nil {
+			return info, nil
+		}
+	}
 	if err != nil {
 		log.Errorf("read file %s error %v.", cfgFile, err)
 		return nil, err
@@ -102,60 +222,80 @@ func getContainerInfoByName(containerName string) (*container.ContainerInfo, err
 	return &info, nil
 }
 
-func updateContainerStatus(containerName string) error {
-	// modify container info
-	info, err := getContainerInfoByName(containerName)
+// getContainerInfoByID returns the info of the container whose ID is id, nil if there is none.
+func getContainerInfoByID(id string) *container.ContainerInfo {
+	dirUrl := fmt.Sprintf(container.DefaultLocation, "")
+	files, err := os.ReadDir(dirUrl)
 	if err != nil {
-		return fmt.Errorf("get container info by name %s error %v", containerName, err)
-	}
-	info.Status = container.STOP
-	info.PID = ""
-
-	newContent, err := sonic.Marshal(info)
-	if err != nil {
-		return fmt.Errorf("json marshal %s error %v", containerName, err)
+		return nil
 	}
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
-	cfgFile := dirUrl + container.ConfigName
-	if err := os.WriteFile(cfgFile, newContent, 0622); err != nil {
-		return fmt.Errorf("write file %s error %v", cfgFile, err)
+	for _, f := range files {
+		info, err := getContainerInfo(f)
+		if err == nil && info.ID == id {
+			return info
+		}
 	}
-
 	return nil
 }
 
+func updateContainerStatus(containerName string) error {
+	// modify container info
+	err := updateContainerInfo(containerName, func(info *container.ContainerInfo) {
+		info.Status = container.STOP
+		info.PID = ""
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		// started with --rm, it is already gone
+		return nil
+	}
+	return err
+}
+
+// parseSignal parses a signal given by its name, with or without the SIG prefix,
+// as RTMIN+n or RTMAX-n for the real-time ones, or by its number.
 func parseSignal(signalStr string) (syscall.Signal, error) {
-	switch strings.ToUpper(signalStr) {
-	case "SIGTERM", "TERM", "15":
-		return syscall.SIGTERM, nil
-	case "SIGKILL", "KILL", "9":
-		return syscall.SIGKILL, nil
-	case "SIGINT", "INT", "2":
-		return syscall.SIGINT, nil
-	case "SIGQUIT", "QUIT", "3":
-		return syscall.SIGQUIT, nil
-	case "SIGHUP", "HUP", "1":
-		return syscall.SIGHUP, nil
+	if num, err := strconv.Atoi(signalStr); err == nil {
+		if num <= 0 || num > sigRTMax {
+			return 0, fmt.Errorf("invalid signal number: %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.ToUpper(signalStr)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	switch {
+	case name == "SIGRTMIN":
+		return sigRTMin, nil
+	case name == "SIGRTMAX":
+		return sigRTMax, nil
+	case strings.HasPrefix(name, "SIGRTMIN+"):
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "SIGRTMIN+"))
+		if err == nil && n >= 0 && sigRTMin+n <= sigRTMax {
+			return syscall.Signal(sigRTMin + n), nil
+		}
+	case strings.HasPrefix(name, "SIGRTMAX-"):
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "SIGRTMAX-"))
+		if err == nil && n >= 0 && sigRTMax-n >= sigRTMin {
+			return syscall.Signal(sigRTMax - n), nil
+		}
 	default:
-		return 0, fmt.Errorf("unsupported signal: %s (supported: SIGTERM/15, SIGKILL/9, SIGINT/2, SIGQUIT/3, SIGHUP/1)", signalStr)
+		if sig := unix.SignalNum(name); sig != 0 {
+			return sig, nil
+		}
 	}
+
+	return 0, fmt.Errorf("unsupported signal: %s", signalStr)
 }
 
 func waitForContainerStop(pid int, containerName string, timeout int) error {
-	stopped := make(chan bool)
-	errCh := make(chan error)
-	done := make(chan struct{}) // To notify the goroutine to stop
+	// buffered so that the goroutine never blocks on a result nobody waits for anymore
+	stopped := make(chan bool, 1)
+	errCh := make(chan error, 1)
+	done := make(chan struct{}) // To notify the goroutine to stop, closed by the waiting side only
 
 	go func() {
-		defer func() {
-			// Make sure the channel is closed no matter how you exit
-			select {
-			case <-done:
-			default:
-				close(done)
-			}
-		}()
-
 		for {
 			select {
 			case <-done:
@@ -197,7 +337,8 @@ func waitForContainerStop(pid int, containerName string, timeout int) error {
 		case <-time.After(time.Duration(timeout) * time.Second):
 			close(done)
 			log.Infof("Container %s not stopped after %d seconds, sending SIGKILL", containerName, timeout)
-			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+			// it may have exited by itself in the meantime
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
 				return fmt.Errorf("send SIGKILL failed: %v", err)
 			}
 			return updateContainerStatus(containerName)
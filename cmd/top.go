@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// clockTicks is the number of clock ticks per second the CPU times in /proc/<pid>/stat are counted in
+const clockTicks = 100
+
+const defaultTopColumns = "pid,hostpid,user,time,rss,cmd"
+
+type topOptions struct {
+	columns string
+}
+
+// topProcess is a process of a container as read from /proc.
+type topProcess struct {
+	pid     int
+	hostPID int
+	// nsPIDs are the pids of the process in the pid namespaces it is in, from the outermost one
+	nsPIDs []int
+	ppid   int
+	uid    int
+	state  string
+	// cpuTicks is the user and system CPU time in clock ticks
+	cpuTicks uint64
+	// rss is the resident set size in kB
+	rss     int64
+	command string
+}
+
+// topColumn is a column -o can select.
+type topColumn struct {
+	header string
+	value  func(p *topProcess, users map[int]string) string
+}
+
+var topColumns = map[string]topColumn{
+	"pid":     {"PID", func(p *topProcess, _ map[int]string) string { return strconv.Itoa(p.pid) }},
+	"hostpid": {"HOST PID", func(p *topProcess, _ map[int]string) string { return strconv.Itoa(p.hostPID) }},
+	"ppid":    {"PPID", func(p *topProcess, _ map[int]string) string { return strconv.Itoa(p.ppid) }},
+	"uid":     {"UID", func(p *topProcess, _ map[int]string) string { return strconv.Itoa(p.uid) }},
+	"user": {"USER", func(p *topProcess, users map[int]string) string {
+		if name, ok := users[p.uid]; ok {
+			return name
+		}
+		return strconv.Itoa(p.uid)
+	}},
+	"stat": {"STAT", func(p *topProcess, _ map[int]string) string { return p.state }},
+	"time": {"TIME", func(p *topProcess, _ map[int]string) string { return formatCPUTime(p.cpuTicks) }},
+	"rss":  {"RSS", func(p *topProcess, _ map[int]string) string { return strconv.FormatInt(p.rss, 10) }},
+	"cmd":  {"CMD", func(p *topProcess, _ map[int]string) string { return p.command }},
+}
+
+func NewTopCommand() *cobra.Command {
+	var option topOptions
+
+	cmd := &cobra.Command{
+		Use:   "top [OPTIONS] CONTAINER",
+		Short: "Display the running processes of a container",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			return containerTop(args[0], option.columns)
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&option.columns, "output", "o", defaultTopColumns,
+		"comma separated columns to show (pid, hostpid, ppid, uid, user, stat, time, rss, cmd)")
+
+	return cmd
+}
+
+// containerTop lists the processes in the cgroup of the container. The pids are those
+// in the pid namespace of the container next to those on the host, the users those of the container.
+func containerTop(containerName string, columns string) error {
+	var selected []topColumn
+	for _, name := range strings.Split(columns, ",") {
+		column, ok := topColumns[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		selected = append(selected, column)
+	}
+
+	info, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	if info.Status != container.RUNNING || info.CgroupPath == "" {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	pids, err := cgroups.NewCgroupManager(info.CgroupPath).GetPids()
+	if err != nil {
+		return fmt.Errorf("get processes of container %s error %v", containerName, err)
+	}
+	slices.Sort(pids)
+	initPID, err := strconv.Atoi(info.PID)
+	if err != nil {
+		return fmt.Errorf("convert pid from string to int error %v", err)
+	}
+	init, err := readTopProcess(initPID)
+	if err != nil {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	// how deep the pid namespace of the container is nested
+	depth := len(init.nsPIDs)
+
+	processes := make([]*topProcess, 0, len(pids))
+	nsPIDs := map[int]int{}
+	for _, pid := range pids {
+		// the process may have exited since the cgroup was read
+		p, err := readTopProcess(pid)
+		if err != nil {
+			continue
+		}
+		if depth > 0 {
+			// exec and the health checks join the cgroup before the pid namespace, their helpers never do
+			if len(p.nsPIDs) < depth {
+				continue
+			}
+			p.pid = p.nsPIDs[depth-1]
+		}
+		processes = append(processes, p)
+		nsPIDs[pid] = p.pid
+	}
+	users := container.UserNames(fmt.Sprintf(container.MntUrl, info.Name))
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	headers := make([]string, 0, len(selected))
+	for _, column := range selected {
+		headers = append(headers, column.header)
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, p := range processes {
+		// the parent is shown by its pid in the container, a parent outside of it as 0
+		p.ppid = nsPIDs[p.ppid]
+		values := make([]string, 0, len(selected))
+		for _, column := range selected {
+			values = append(values, column.value(p, users))
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// readTopProcess reads the process pid from /proc, its pid and ppid are those on the host.
+func readTopProcess(pid int) (*topProcess, error) {
+	p := &topProcess{hostPID: pid, pid: pid}
+
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "NSpid":
+			for _, field := range fields {
+				nsPID, _ := strconv.Atoi(field)
+				p.nsPIDs = append(p.nsPIDs, nsPID)
+			}
+		case "PPid":
+			p.ppid, _ = strconv.Atoi(fields[0])
+		case "Uid":
+			// real, effective, saved and filesystem ids, ps shows the effective one
+			if len(fields) > 1 {
+				p.uid, _ = strconv.Atoi(fields[1])
+			}
+		case "VmRSS":
+			p.rss, _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// pid (comm) state ppid ..., the command name may contain spaces
+	statStr := string(stat)
+	comm := statStr[strings.IndexByte(statStr, '(')+1 : strings.LastIndexByte(statStr, ')')]
+	fields := strings.Fields(statStr[strings.LastIndexByte(statStr, ')')+1:])
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	p.state = fields[0]
+	// utime and stime are the 14th and 15th fields of the whole line
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	p.cpuTicks = utime + stime
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	p.command = strings.Join(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), " ")
+	if p.command == "" {
+		// a zombie has no command line left
+		p.command = "[" + comm + "]"
+	}
+
+	return p, nil
+}
+
+// formatCPUTime formats clock ticks like ps does, [dd-]hh:mm:ss.
+func formatCPUTime(ticks uint64) string {
+	seconds := ticks / clockTicks
+	days := seconds / 86400
+	hms := fmt.Sprintf("%02d:%02d:%02d", seconds/3600%24, seconds/60%60, seconds%60)
+	if days > 0 {
+		return fmt.Sprintf("%d-%s", days, hms)
+	}
+	return hms
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+const (
+	// waitPollInterval is how often wait checks the status of the container
+	waitPollInterval = 200 * time.Millisecond
+	// waitExitGrace is how long the shim gets to record the exit of its container
+	waitExitGrace = 2 * time.Second
+	// waitRemoveTimeout is how long removing a container waits for wait to read its exit code
+	waitRemoveTimeout = 2 * time.Second
+)
+
+func NewWaitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait [CONTAINER...]",
+		Short: "Block until containers stop, then print their exit codes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing container name")
+			}
+			for _, containerName := range args {
+				exitCode, err := waitContainerExit(containerName)
+				if err != nil {
+					return err
+				}
+				fmt.Println(exitCode)
+			}
+
+			return nil
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	return cmd
+}
+
+// waitContainerExit blocks until the container has stopped or exited and returns its exit code.
+// A container that is restarted by its restart policy is still waited for,
+// a container that has not been started is an error.
+//
+// A container started with --rm is removed once it exits: the removal waits until the exit code
+// has been read, which the shared lock on its wait lock file tells.
+func waitContainerExit(containerName string) (int, error) {
+	info, err := getContainerInfoByName(containerName)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("no such container: %s", containerName)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get container info by name %s error %v", containerName, err)
+	}
+	containerName = info.Name
+
+	lockFile := fmt.Sprintf(container.DefaultLocation, containerName) + container.WaitLockFile
+	lock, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDONLY, 0600)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("no such container: %s", containerName)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open %s error %v", lockFile, err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_SH); err != nil {
+		return 0, fmt.Errorf("lock %s error %v", lockFile, err)
+	}
+
+	// when the process of a running container is gone
+	var goneSince time.Time
+	for {
+		info, err := getContainerInfoByName(containerName)
+		if errors.Is(err, os.ErrNotExist) {
+			// removed before the lock was taken
+			return 0, fmt.Errorf("container %s was removed", containerName)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("get container info by name %s error %v", containerName, err)
+		}
+
+		switch info.Status {
+		case container.STOP, container.EXIT:
+			return info.ExitCode, nil
+		case container.CREATED:
+			return 0, fmt.Errorf("container %s has not been started", containerName)
+		case container.RUNNING:
+			if isProcessRunning(info.PID) {
+				goneSince = time.Time{}
+				break
+			}
+			// the shim records the exit soon after, unless it was killed itself
+			if goneSince.IsZero() {
+				goneSince = time.Now()
+			} else if time.Since(goneSince) > waitExitGrace {
+				if err := updateContainerStatusToExit(containerName); err != nil {
+					return 0, err
+				}
+			}
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// waitForWaiters waits a bounded time for the wait commands of the container to read its exit code
+// before the container is removed.
+func waitForWaiters(dirUrl string) {
+	lock, err := os.OpenFile(dirUrl+container.WaitLockFile, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer lock.Close()
+
+	deadline := time.Now().Add(waitRemoveTimeout)
+	for {
+		err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil || !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(waitPollInterval / 4)
+	}
+}
@@ -0,0 +1,67 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// ImageConfigUrl is the config of an image, next to its tarball.
+const ImageConfigUrl = "/root/%s.json"
+
+// controlEnv are the variables telling the nsenter constructor and the container init
+// what to do, they are not part of the environment of the container.
+var controlEnv = []string{"ZDOCKER_CREATE", "ZDOCKER_INIT", "ZDOCKER_TTY", "ZDOCKER_PID_FD"}
+
+// ImageConfig is what an image sets for the containers running it.
+type ImageConfig struct {
+	Env []string `json:"env"`
+}
+
+// ReadImageConfig reads the config of the image, an image without one has an empty config.
+func ReadImageConfig(imageName string) (*ImageConfig, error) {
+	config := &ImageConfig{}
+	content, err := os.ReadFile(fmt.Sprintf(ImageConfigUrl, imageName))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := sonic.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("parse config of image %s error %v", imageName, err)
+	}
+
+	return config, nil
+}
+
+// DefaultEnv adds to env the variables every container has unless they are set:
+// a PATH, and the TERM of the pty when there is one.
+func DefaultEnv(env []string, tty bool) []string {
+	has := func(key string) bool {
+		for _, kv := range env {
+			if strings.HasPrefix(kv, key+"=") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !has("PATH") {
+		env = append([]string{"PATH=" + defaultPath}, env...)
+	}
+	if tty && !has("TERM") {
+		env = append(env, "TERM=xterm")
+	}
+	return env
+}
+
+// clearControlEnv leaves the container init with the environment of the container only.
+func clearControlEnv() {
+	for _, key := range controlEnv {
+		os.Unsetenv(key)
+	}
+}
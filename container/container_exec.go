@@ -0,0 +1,93 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const (
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// ExecDir is the directory of the container directory holding a <session id>.json per exec session
+	ExecDir = "exec"
+)
+
+// ExecSession records a process run in a container by exec.
+type ExecSession struct {
+	ID      string   `json:"id"`
+	Command []string `json:"command"`
+	// PID is the host pid of the process.
+	PID        string `json:"pid"`
+	Detached   bool   `json:"detached"`
+	Running    bool   `json:"running"`
+	StartTime  string `json:"startTime"`
+	FinishTime string `json:"finishTime"`
+	ExitCode   int    `json:"exitCode"`
+}
+
+// ExecSpec describes a process run in a running container by exec.
+type ExecSpec struct {
+	// Args is the argv of the process, Args[0] is looked up in the PATH of Env.
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	// Dir is the working directory, / if empty.
+	Dir string `json:"dir"`
+	// User is user[:group] by name or id, the user of Security if empty.
+	User string `json:"user"`
+	// Security is the security context of the main process of the container, the process gets the same.
+	Security *Security `json:"security"`
+}
+
+// RunExecProcess replaces the current process by the one described by spec.
+// It runs after the nsenter constructor has joined the namespaces of the container
+// and forked, so the process is a child in the pid namespace of the container,
+// and / is the root of the container.
+func RunExecProcess(spec *ExecSpec) error {
+	if len(spec.Args) == 0 {
+		return fmt.Errorf("exec missing command")
+	}
+
+	// look the command up in the PATH of the container, not ours
+	os.Setenv("PATH", defaultPath)
+	for _, env := range spec.Env {
+		if value, ok := strings.CutPrefix(env, "PATH="); ok {
+			os.Setenv("PATH", value)
+		}
+	}
+	path, err := exec.LookPath(spec.Args[0])
+	if err != nil {
+		return err
+	}
+
+	dir := spec.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	if err := syscall.Chdir(dir); err != nil {
+		return fmt.Errorf("chdir to %s error %v", dir, err)
+	}
+
+	var user *User
+	if spec.User != "" {
+		if user, err = LookupUser(spec.User); err != nil {
+			return err
+		}
+	}
+	if spec.Security != nil {
+		if user != nil {
+			spec.Security.User = *user
+		}
+		if err := spec.Security.Apply(); err != nil {
+			return err
+		}
+	} else if user != nil {
+		if err := user.Apply(); err != nil {
+			return err
+		}
+	}
+
+	return syscall.Exec(path, spec.Args, spec.Env)
+}
@@ -0,0 +1,88 @@
+package container
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+
+	HealthOnFailureNone = "none"
+	HealthOnFailureKill = "kill"
+	HealthOnFailureStop = "stop"
+
+	// maxHealthLogs is how many results of the health check are kept
+	maxHealthLogs = 5
+)
+
+// HealthConfig describes the health check of a container.
+type HealthConfig struct {
+	// Cmd runs inside the container through a shell, exiting with 0 means healthy.
+	Cmd      string        `json:"cmd"`
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+	// Retries is how many failures in a row make the container unhealthy.
+	Retries int `json:"retries"`
+	// OnFailure is what happens to the container once it becomes unhealthy: none, kill or stop.
+	OnFailure string `json:"onFailure"`
+}
+
+// Validate checks the values given on the command line.
+func (c *HealthConfig) Validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("health interval must be positive")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("health timeout must be positive")
+	}
+	if c.Retries < 1 {
+		return fmt.Errorf("health retries must be at least 1")
+	}
+	switch c.OnFailure {
+	case HealthOnFailureNone, HealthOnFailureKill, HealthOnFailureStop:
+		return nil
+	default:
+		return fmt.Errorf("invalid health on failure action %q (supported: none, kill, stop)", c.OnFailure)
+	}
+}
+
+// HealthResult is the result of one run of the health check.
+type HealthResult struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output"`
+}
+
+// Health is the health state of a running container.
+type Health struct {
+	Status        string         `json:"status"`
+	FailingStreak int            `json:"failingStreak"`
+	Log           []HealthResult `json:"log"`
+}
+
+// Record adds a result of the health check and updates the status,
+// it reports whether the container has just become unhealthy.
+func (h *Health) Record(result HealthResult, retries int) bool {
+	h.Log = append(h.Log, result)
+	if len(h.Log) > maxHealthLogs {
+		h.Log = h.Log[len(h.Log)-maxHealthLogs:]
+	}
+
+	if result.ExitCode == 0 {
+		h.FailingStreak = 0
+		h.Status = HealthHealthy
+		return false
+	}
+
+	h.FailingStreak++
+	if h.FailingStreak >= retries && h.Status != HealthUnhealthy {
+		h.Status = HealthUnhealthy
+		return true
+	}
+
+	return false
+}
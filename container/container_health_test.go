@@ -0,0 +1,32 @@
+package container
+
+import "testing"
+
+func TestHealthRecord(t *testing.T) {
+	h := &Health{Status: HealthStarting}
+
+	if h.Record(HealthResult{ExitCode: 1}, 2) {
+		t.Fatal("unhealthy after the first failure with 2 retries")
+	}
+	if h.Status != HealthStarting {
+		t.Fatalf("status %s, want %s", h.Status, HealthStarting)
+	}
+	if !h.Record(HealthResult{ExitCode: 1}, 2) {
+		t.Fatal("not unhealthy after 2 failures in a row")
+	}
+	if h.Record(HealthResult{ExitCode: 1}, 2) {
+		t.Fatal("became unhealthy twice")
+	}
+
+	h.Record(HealthResult{ExitCode: 0}, 2)
+	if h.Status != HealthHealthy || h.FailingStreak != 0 {
+		t.Fatalf("status %s streak %d after a success", h.Status, h.FailingStreak)
+	}
+
+	for i := 0; i < 10; i++ {
+		h.Record(HealthResult{ExitCode: 0}, 2)
+	}
+	if len(h.Log) != maxHealthLogs {
+		t.Fatalf("kept %d results, want %d", len(h.Log), maxHealthLogs)
+	}
+}
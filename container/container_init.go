@@ -12,8 +12,12 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// RunContainerInitProcess execute initialization procedures inside the container
-func RunContainerInitProcess() error {
+// RunContainerInitProcess execute initialization procedures inside the container,
+// with reaper the user command runs under a minimal init instead of replacing this process.
+func RunContainerInitProcess(reaper bool) error {
+	setUpLogging()
+	clearControlEnv()
+	log.Infof("init come on")
 	commands := readUserCommand()
 	if commands == nil || len(commands) == 0 {
 		return fmt.Errorf("run container get user command error, commands is nil")
@@ -27,12 +31,28 @@ func RunContainerInitProcess() error {
 		return err
 	}
 	log.Infof("Find path %s", path)
+	if reaper {
+		return runReaper(path, commands)
+	}
 	if err := syscall.Exec(path, commands[0:], os.Environ()); err != nil {
-		log.Errorf(err.Error())
+		log.Errorf("exec %s error %v", path, err)
 	}
 	return nil
 }
 
+// setUpLogging sends the logs of the container init to the runtime log on fd 5,
+// stdout and stderr belong to the workload.
+func setUpLogging() {
+	runtimeLog := os.NewFile(uintptr(5), RuntimeLogFile)
+	if _, err := runtimeLog.Stat(); err != nil {
+		log.SetOutput(io.Discard)
+		return
+	}
+	// the user command must not inherit it
+	syscall.CloseOnExec(5)
+	log.SetOutput(runtimeLog)
+}
+
 func setUpMount() {
 	// The original mydocker project did not do this here, perhaps because the environment itself supports the mount propagation type to be private,
 	// most distributions default to shared, and pivotRoot requires the current root filesystem to be clean, i.e.,
@@ -103,6 +123,7 @@ func pivotRoot(root string) error {
 func readUserCommand() []string {
 	// Read index 3 (3rd file descriptor) from the pipe
 	pipe := os.NewFile(uintptr(3), "pipe")
+	defer pipe.Close()
 	msg, err := io.ReadAll(pipe)
 	if err != nil {
 		log.Errorf("init read pipe error %v", err)
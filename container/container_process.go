@@ -2,68 +2,228 @@ package container
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 
-	_ "github.com/crazyfrankie/zdocker/nsenter"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/logger"
+	_ "github.com/crazyfrankie/zdocker/nsenter"
+	"github.com/crazyfrankie/zdocker/term"
 )
 
 var (
-	RUNNING = "running"
-	STOP    = "stop"
-	EXIT    = "exit"
+	// CREATED is a container that has been prepared by create but never started
+	CREATED    = "created"
+	RUNNING    = "running"
+	STOP       = "stop"
+	EXIT       = "exit"
+	RESTARTING = "restarting"
 
 	DefaultLocation  = "/var/run/zdocker/containers/%s/"
 	ConfigName       = "config.json"
 	ContainerLogFile = "container.log"
+	AttachSocket     = "attach.sock"
+	// RuntimeLogFile holds the diagnostics of the runtime processes of a container,
+	// so that only the output of the workload goes to the container log
+	RuntimeLogFile = "runtime.log"
+	// WaitLockFile is locked shared by wait until it has read the exit code of the container,
+	// removing the container takes it exclusively
+	WaitLockFile = "wait.lock"
 )
 
 type ContainerInfo struct {
-	PID         string   `json:"pid"`
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Command     string   `json:"command"`
-	CreateTime  string   `json:"createTime"`
-	Status      string   `json:"status"`
-	Volume      string   `json:"volume"`
-	PortMapping []string `json:"portMapping"`
+	PID         string                  `json:"pid"`
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	Image       string                  `json:"image"`
+	Command     string                  `json:"command"`
+	CreateTime  string                  `json:"createTime"`
+	Status      string                  `json:"status"`
+	Volume      string                  `json:"volume"`
+	PortMapping []string                `json:"portMapping"`
+	Network     string                  `json:"network"`
+	Env         []string                `json:"env"`
+	TTY         bool                    `json:"tty"`
+	OpenStdin   bool                    `json:"openStdin"`
+	Resource    *cgroups.ResourceConfig `json:"resource"`
+	CgroupPath  string                  `json:"cgroupPath"`
+	IPAddress   string                  `json:"ipAddress"`
+	ExitCode    int                     `json:"exitCode"`
+	ExitSignal  string                  `json:"exitSignal"`
+	FinishTime  string                  `json:"finishTime"`
+	// Labels are the key=value metadata given with --label and --label-file.
+	Labels map[string]string `json:"labels"`
+
+	RestartPolicy   RestartPolicy `json:"restartPolicy"`
+	RestartCount    int           `json:"restartCount"`
+	ManuallyStopped bool          `json:"manuallyStopped"`
+	// MonitorPID is the shim monitoring the container, it outlives restarts of the container.
+	MonitorPID int `json:"monitorPid"`
+	// Init runs the user command under a minimal init that forwards signals and reaps zombies.
+	Init bool `json:"init"`
+	// AutoRemove removes the container and everything it holds once it exits.
+	AutoRemove bool `json:"autoRemove"`
+
+	LogConfig   logger.Config `json:"logConfig"`
+	Healthcheck *HealthConfig `json:"healthcheck"`
+	Health      *Health       `json:"health"`
+}
+
+// ContainerIO holds the host side of the container's stdio.
+type ContainerIO struct {
+	// Pty is set in tty mode, its master side carries both input and output.
+	Pty *term.Pty
+	// Stdin is the write end of the container's stdin, nil unless stdin is kept open.
+	Stdin *os.File
+	// Stdout is the read end of the container's stdout.
+	Stdout *os.File
+	// Stderr is the read end of the container's stderr, nil in tty mode.
+	Stderr *os.File
+}
+
+// ParentProcess is the process that creates the container,
+// along with the host side of the pipes connected to it.
+type ParentProcess struct {
+	*exec.Cmd
+	// InitPipe is the write end of the pipe the user command is sent through.
+	InitPipe *os.File
+	// IO is the host side of the container's stdio.
+	IO *ContainerIO
+
+	// where the nsenter constructor reports the host pid of the container init
+	pidPipe *os.File
+	// the ends handed to the child, closed by the parent once it is started
+	childFiles []*os.File
+}
+
+// Start starts the process and closes the parent's copies of the ends given to it,
+// so that reading the output ends once the container exits.
+func (p *ParentProcess) Start() error {
+	err := p.Cmd.Start()
+	for _, f := range p.childFiles {
+		f.Close()
+	}
+	p.childFiles = nil
+
+	return err
+}
+
+// ContainerPID returns the host pid of the container init.
+//
+// The started process is only an intermediate one: the nsenter constructor clones
+// the container init into the new namespaces from it and then waits for it,
+// so its own pid refers to the host namespaces.
+func (p *ParentProcess) ContainerPID() (int, error) {
+	defer p.pidPipe.Close()
+
+	data, err := io.ReadAll(p.pidPipe)
+	if err != nil {
+		return 0, fmt.Errorf("read container pid error %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid container pid %q", data)
+	}
+
+	return pid, nil
 }
 
 // NewParentProcess Build a new cmd that creates the container process.
-func NewParentProcess(imageName string, containerName string, volume string, tty bool, envs []string) (*exec.Cmd, *os.File) {
+// When tty is enabled, a pty is allocated and its slave side becomes the controlling terminal of the container.
+// Otherwise stdout and stderr of the container go to separate pipes, and stdin is a pipe as well when interactive is enabled.
+// With reaper the user command runs under a minimal init instead of being pid 1 itself.
+// The caller owns the host side returned in ContainerIO.
+func NewParentProcess(imageName string, containerName string, volume string, tty bool, interactive bool, reaper bool, envs []string) *ParentProcess {
 	readPipe, writePipe, err := newPipe()
 	if err != nil {
 		log.Errorf("New pipe error %v", err)
-		return nil, nil
+		return nil
+	}
+	pidRead, pidWrite, err := newPipe()
+	if err != nil {
+		log.Errorf("New pid pipe error %v", err)
+		return nil
 	}
 
-	os.Setenv("ZDOCKER_CREATE", "1")
+	dirUrl := fmt.Sprintf(DefaultLocation, containerName)
+	if err := os.MkdirAll(dirUrl, 0622); err != nil {
+		log.Errorf("NewParentProcess mkdir %s error %v", dirUrl, err)
+		return nil
+	}
+	runtimeLog, err := os.OpenFile(dirUrl+RuntimeLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		log.Errorf("NewParentProcess open runtime log error %v", err)
+		return nil
+	}
 
-	cmd := exec.Command("/proc/self/exe", "init")
+	cmd := exec.Command("/proc/self/exe", "init", "--log-level", log.GetLevel().String())
+	if reaper {
+		cmd.Args = append(cmd.Args, "--reaper")
+	}
+	parent := &ParentProcess{
+		Cmd:        cmd,
+		InitPipe:   writePipe,
+		IO:         &ContainerIO{},
+		pidPipe:    pidRead,
+		childFiles: []*os.File{readPipe, pidWrite, runtimeLog},
+	}
 	if tty {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		pty, err := term.NewPty()
+		if err != nil {
+			log.Errorf("NewParentProcess new pty error %v", err)
+			return nil
+		}
+		cmd.Stdin = pty.Slave
+		cmd.Stdout = pty.Slave
+		cmd.Stderr = pty.Slave
+		parent.IO.Pty = pty
+		parent.childFiles = append(parent.childFiles, pty.Slave)
 	} else {
-		dirUrl := fmt.Sprintf(DefaultLocation, containerName)
-		if err := os.MkdirAll(dirUrl, 0622); err != nil {
-			log.Errorf("NewParentProcess mkdir %s error %v.", dirUrl, err)
-			return nil, nil
+		stdoutRead, stdoutWrite, err := newPipe()
+		if err != nil {
+			log.Errorf("NewParentProcess new stdout pipe error %v", err)
+			return nil
 		}
-		logFile := dirUrl + ContainerLogFile
-		stdLogFile, err := os.Create(logFile)
+		stderrRead, stderrWrite, err := newPipe()
 		if err != nil {
-			log.Errorf("NewParentProcess create file %s error %v", logFile, err)
-			return nil, nil
+			log.Errorf("NewParentProcess new stderr pipe error %v", err)
+			return nil
+		}
+		cmd.Stdout = stdoutWrite
+		cmd.Stderr = stderrWrite
+		parent.IO.Stdout = stdoutRead
+		parent.IO.Stderr = stderrRead
+		parent.childFiles = append(parent.childFiles, stdoutWrite, stderrWrite)
+		if interactive {
+			stdinRead, stdinWrite, err := newPipe()
+			if err != nil {
+				log.Errorf("NewParentProcess new stdin pipe error %v", err)
+				return nil
+			}
+			cmd.Stdin = stdinRead
+			parent.IO.Stdin = stdinWrite
+			parent.childFiles = append(parent.childFiles, stdinRead)
 		}
-		cmd.Stdout = stdLogFile
 	}
-	cmd.ExtraFiles = []*os.File{readPipe}
-	cmd.Env = append(os.Environ(), envs...)
+	// fd 3 carries the user command to the container init,
+	// fd 4 is where the nsenter constructor writes the pid of the container init,
+	// fd 5 is where the container init logs
+	cmd.ExtraFiles = []*os.File{readPipe, pidWrite, runtimeLog}
+	// the container starts with envs only, nothing of ours leaks into it
+	cmd.Env = append(slices.Clone(envs), "ZDOCKER_CREATE=1", "ZDOCKER_PID_FD=4")
+	if tty {
+		// tell the nsenter constructor to make the pty the controlling terminal of the container init
+		cmd.Env = append(cmd.Env, "ZDOCKER_TTY=1")
+	}
 	NewWorkSpace(imageName, containerName, volume)
 	cmd.Dir = fmt.Sprintf(MntUrl, containerName)
-	return cmd, writePipe
+	return parent
 }
 
 func newPipe() (*os.File, *os.File, error) {
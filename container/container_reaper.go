@@ -0,0 +1,84 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/crazyfrankie/zdocker/term"
+)
+
+// runReaper keeps the container init as pid 1 instead of replacing it by the user command:
+// the command runs as a child in its own process group, every signal received is
+// forwarded to that group, orphans reparented to us are reaped, and we exit with
+// the status of the command once it exits.
+//
+// A user command that is not written to be pid 1 would otherwise ignore SIGTERM
+// and leave zombies behind.
+func runReaper(path string, argv []string) error {
+	// subscribe before starting the child so that neither its exit nor a signal is missed
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if term.IsTerminal(os.Stdin.Fd()) {
+		// the process group of the command must own the terminal for job control and ctrl-c
+		attr.Foreground = true
+		attr.Ctty = 0
+	}
+	process, err := os.StartProcess(path, argv, &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   attr,
+	})
+	if err != nil {
+		return fmt.Errorf("start %s error %v", path, err)
+	}
+	pid := process.Pid
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			if status, exited := reapChildren(pid); exited {
+				os.Exit(waitStatusCode(status))
+			}
+		case syscall.SIGURG:
+			// used by the Go runtime to preempt goroutines, it is not meant for the command
+		default:
+			// the command may have moved itself to another group, signal it directly then
+			if err := syscall.Kill(-pid, sig.(syscall.Signal)); err != nil {
+				syscall.Kill(pid, sig.(syscall.Signal))
+			}
+		}
+	}
+
+	return nil
+}
+
+// reapChildren waits for every child that has exited, and reports
+// the wait status of the command pid if it is one of them.
+func reapChildren(pid int) (syscall.WaitStatus, bool) {
+	for {
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return 0, false
+		}
+		if wpid == pid {
+			return status, true
+		}
+	}
+}
+
+// waitStatusCode converts a wait status into an exit code, 128 + signal for a killed process.
+// pid 1 can not kill itself with the signal, so the status is passed on as an exit code.
+func waitStatusCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
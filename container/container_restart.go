@@ -0,0 +1,83 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartAlways        = "always"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// RestartPolicy decides whether the shim restarts a container after it exits.
+type RestartPolicy struct {
+	Name string `json:"name"`
+	// MaximumRetryCount limits the restarts of on-failure, 0 means no limit.
+	MaximumRetryCount int `json:"maximumRetryCount"`
+}
+
+// ParseRestartPolicy parses the value of --restart: no, on-failure[:N], always or unless-stopped.
+func ParseRestartPolicy(policy string) (RestartPolicy, error) {
+	if policy == "" {
+		return RestartPolicy{Name: RestartNo}, nil
+	}
+
+	name, count, hasCount := strings.Cut(policy, ":")
+	switch name {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasCount {
+			return RestartPolicy{}, fmt.Errorf("maximum retry count can only be used with %s", RestartOnFailure)
+		}
+		return RestartPolicy{Name: name}, nil
+	case RestartOnFailure:
+		if !hasCount {
+			return RestartPolicy{Name: name}, nil
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return RestartPolicy{}, fmt.Errorf("invalid maximum retry count %q", count)
+		}
+		return RestartPolicy{Name: name, MaximumRetryCount: n}, nil
+	default:
+		return RestartPolicy{}, fmt.Errorf("invalid restart policy %q", policy)
+	}
+}
+
+// IsNone reports whether the container is never restarted.
+func (p RestartPolicy) IsNone() bool {
+	return p.Name == "" || p.Name == RestartNo
+}
+
+// ShouldRestart reports whether a container that exited with exitCode after
+// being restarted restartCount times is restarted again.
+// A container stopped by the user is never restarted, the caller checks that.
+//
+// always and unless-stopped only differ when the runtime itself restarts,
+// zdocker has no daemon, so both restart the container whatever its exit code is.
+func (p RestartPolicy) ShouldRestart(exitCode int, restartCount int) bool {
+	switch p.Name {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		if exitCode == 0 {
+			return false
+		}
+		return p.MaximumRetryCount == 0 || restartCount < p.MaximumRetryCount
+	default:
+		return false
+	}
+}
+
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaximumRetryCount)
+	}
+	if p.Name == "" {
+		return RestartNo
+	}
+	return p.Name
+}
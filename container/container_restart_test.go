@@ -0,0 +1,54 @@
+package container
+
+import "testing"
+
+func TestParseRestartPolicy(t *testing.T) {
+	cases := []struct {
+		policy  string
+		want    RestartPolicy
+		wantErr bool
+	}{
+		{policy: "", want: RestartPolicy{Name: RestartNo}},
+		{policy: "no", want: RestartPolicy{Name: RestartNo}},
+		{policy: "always", want: RestartPolicy{Name: RestartAlways}},
+		{policy: "unless-stopped", want: RestartPolicy{Name: RestartUnlessStopped}},
+		{policy: "on-failure", want: RestartPolicy{Name: RestartOnFailure}},
+		{policy: "on-failure:3", want: RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}},
+		{policy: "on-failure:-1", wantErr: true},
+		{policy: "always:3", wantErr: true},
+		{policy: "sometimes", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRestartPolicy(c.policy)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("ParseRestartPolicy(%q) error %v", c.policy, err)
+		}
+		if got != c.want {
+			t.Fatalf("ParseRestartPolicy(%q) = %+v, want %+v", c.policy, got, c.want)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	onFailure := RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 2}
+	if onFailure.ShouldRestart(0, 0) {
+		t.Fatal("on-failure restarted a container that exited with 0")
+	}
+	if !onFailure.ShouldRestart(1, 1) {
+		t.Fatal("on-failure did not restart a failed container under the retry limit")
+	}
+	if onFailure.ShouldRestart(1, 2) {
+		t.Fatal("on-failure restarted a container over the retry limit")
+	}
+
+	always := RestartPolicy{Name: RestartAlways}
+	if !always.ShouldRestart(0, 100) {
+		t.Fatal("always did not restart the container")
+	}
+
+	no := RestartPolicy{Name: RestartNo}
+	if no.ShouldRestart(1, 0) {
+		t.Fatal("no restarted the container")
+	}
+}
@@ -0,0 +1,149 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Security is the security context of a process: who it runs as, its capabilities and no_new_privs.
+//
+// Seccomp filters are not part of it: zdocker installs none of its own, so a process it starts
+// in the container inherits the same filters as the container, those zdocker itself runs under.
+type Security struct {
+	User           User   `json:"user"`
+	CapInheritable uint64 `json:"capInheritable"`
+	CapPermitted   uint64 `json:"capPermitted"`
+	CapEffective   uint64 `json:"capEffective"`
+	CapBounding    uint64 `json:"capBounding"`
+	CapAmbient     uint64 `json:"capAmbient"`
+	NoNewPrivs     bool   `json:"noNewPrivs"`
+}
+
+// ReadSecurity reads the security context of the process pid, so that
+// another process can be started with the same one.
+func ReadSecurity(pid int) (*Security, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &Security{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Uid":
+			// real, effective, saved and filesystem ids, the process runs as the effective one
+			if fields := strings.Fields(value); len(fields) > 1 {
+				s.User.Uid, err = strconv.Atoi(fields[1])
+			}
+		case "Gid":
+			if fields := strings.Fields(value); len(fields) > 1 {
+				s.User.Gid, err = strconv.Atoi(fields[1])
+			}
+		case "Groups":
+			for _, field := range strings.Fields(value) {
+				gid, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("parse groups %q error %v", value, err)
+				}
+				s.User.Groups = append(s.User.Groups, gid)
+			}
+		case "CapInh":
+			s.CapInheritable, err = strconv.ParseUint(value, 16, 64)
+		case "CapPrm":
+			s.CapPermitted, err = strconv.ParseUint(value, 16, 64)
+		case "CapEff":
+			s.CapEffective, err = strconv.ParseUint(value, 16, 64)
+		case "CapBnd":
+			s.CapBounding, err = strconv.ParseUint(value, 16, 64)
+		case "CapAmb":
+			s.CapAmbient, err = strconv.ParseUint(value, 16, 64)
+		case "NoNewPrivs":
+			s.NoNewPrivs = value == "1"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s of process %d error %v", key, pid, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Apply gives the current thread the security context, it must be the thread
+// that execs the process, which then keeps the context.
+func (s *Security) Apply() error {
+	runtime.LockOSThread()
+
+	for c := 0; c < 64; c++ {
+		if s.CapBounding&(1<<c) != 0 {
+			continue
+		}
+		// capabilities the kernel does not know about are not in the bounding set anyway
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("drop capability %d from the bounding set error %v", c, err)
+		}
+	}
+
+	// keep the permitted capabilities when switching to a user other than root
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set keepcaps error %v", err)
+	}
+	if err := s.User.Apply(); err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear keepcaps error %v", err)
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{
+		{
+			Effective:   uint32(s.CapEffective),
+			Permitted:   uint32(s.CapPermitted),
+			Inheritable: uint32(s.CapInheritable),
+		},
+		{
+			Effective:   uint32(s.CapEffective >> 32),
+			Permitted:   uint32(s.CapPermitted >> 32),
+			Inheritable: uint32(s.CapInheritable >> 32),
+		},
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("set capabilities error %v", err)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear ambient capabilities error %v", err)
+	}
+	for c := 0; c < 64; c++ {
+		if s.CapAmbient&(1<<c) == 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient capability %d error %v", c, err)
+		}
+	}
+
+	if s.NoNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs error %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	passwdFile = "/etc/passwd"
+	groupFile  = "/etc/group"
+)
+
+// User is who a process runs as in the container.
+type User struct {
+	Uid    int   `json:"uid"`
+	Gid    int   `json:"gid"`
+	Groups []int `json:"groups"`
+}
+
+// LookupUser resolves user[:group], each given by name or id, against /etc/passwd and /etc/group
+// of the root the caller is in. Without a group the primary group of the user is used,
+// and the user gets the supplementary groups it is a member of.
+func LookupUser(spec string) (*User, error) {
+	return lookupUser(spec, passwdFile, groupFile)
+}
+
+func lookupUser(spec string, passwdPath string, groupPath string) (*User, error) {
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+	passwd, _ := readColonFile(passwdPath, 7)
+	groups, _ := readColonFile(groupPath, 4)
+
+	user := &User{}
+	name := ""
+	if uid, err := strconv.Atoi(userPart); err == nil {
+		user.Uid = uid
+		for _, entry := range passwd {
+			if entry[2] == userPart {
+				name = entry[0]
+				user.Gid, _ = strconv.Atoi(entry[3])
+				break
+			}
+		}
+	} else {
+		found := false
+		for _, entry := range passwd {
+			if entry[0] == userPart {
+				name = entry[0]
+				user.Uid, _ = strconv.Atoi(entry[2])
+				user.Gid, _ = strconv.Atoi(entry[3])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userPart)
+		}
+	}
+
+	if hasGroup {
+		if gid, err := strconv.Atoi(groupPart); err == nil {
+			user.Gid = gid
+		} else {
+			found := false
+			for _, entry := range groups {
+				if entry[0] == groupPart {
+					user.Gid, _ = strconv.Atoi(entry[2])
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupPart)
+			}
+		}
+		return user, nil
+	}
+
+	if name != "" {
+		for _, entry := range groups {
+			for _, member := range strings.Split(entry[3], ",") {
+				if member == name {
+					gid, err := strconv.Atoi(entry[2])
+					if err == nil && gid != user.Gid {
+						user.Groups = append(user.Groups, gid)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// UserNames maps the uids of the users in the passwd file under root to their names.
+func UserNames(root string) map[int]string {
+	passwd, _ := readColonFile(filepath.Join(root, passwdFile), 7)
+
+	names := make(map[int]string, len(passwd))
+	for _, entry := range passwd {
+		uid, err := strconv.Atoi(entry[2])
+		if err != nil {
+			continue
+		}
+		if _, ok := names[uid]; !ok {
+			names[uid] = entry[0]
+		}
+	}
+	return names
+}
+
+// Apply switches the current process to the user, the groups first while it still can.
+func (u *User) Apply() error {
+	if err := syscall.Setgroups(u.Groups); err != nil {
+		return fmt.Errorf("setgroups error %v", err)
+	}
+	if err := syscall.Setgid(u.Gid); err != nil {
+		return fmt.Errorf("setgid %d error %v", u.Gid, err)
+	}
+	if err := syscall.Setuid(u.Uid); err != nil {
+		return fmt.Errorf("setuid %d error %v", u.Uid, err)
+	}
+	return nil
+}
+
+// readColonFile reads a passwd style file, keeping the lines with at least fields fields.
+func readColonFile(path string, fields int) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := strings.Split(line, ":")
+		if len(entry) < fields {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,40 @@
+package container
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLookupUser(t *testing.T) {
+	dir := t.TempDir()
+	passwd := dir + "/passwd"
+	group := dir + "/group"
+	os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/sh\nweb:x:1000:1000::/home/web:/bin/sh\n"), 0644)
+	os.WriteFile(group, []byte("root:x:0:\nweb:x:1000:\nwww-data:x:33:web\nadm:x:4:root,web\n"), 0644)
+
+	cases := []struct {
+		spec    string
+		want    User
+		wantErr bool
+	}{
+		{spec: "root", want: User{Uid: 0, Gid: 0, Groups: []int{4}}},
+		{spec: "web", want: User{Uid: 1000, Gid: 1000, Groups: []int{33, 4}}},
+		{spec: "1000", want: User{Uid: 1000, Gid: 1000, Groups: []int{33, 4}}},
+		{spec: "web:adm", want: User{Uid: 1000, Gid: 4}},
+		{spec: "2000:2000", want: User{Uid: 2000, Gid: 2000}},
+		{spec: "2000", want: User{Uid: 2000, Gid: 0}},
+		{spec: "nobody", wantErr: true},
+		{spec: "web:nogroup", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := lookupUser(c.spec, passwd, group)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("lookupUser(%q) error %v", c.spec, err)
+		}
+		if err == nil && !reflect.DeepEqual(*got, c.want) {
+			t.Fatalf("lookupUser(%q) = %+v, want %+v", c.spec, *got, c.want)
+		}
+	}
+}
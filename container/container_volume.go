@@ -72,6 +72,10 @@ func createMountPoint(imageName string, containerName string) {
 	if err := os.MkdirAll(mntUrl, 0777); err != nil {
 		log.Errorf("mkdir mount point error: %v", err)
 	}
+	// a restarted container keeps the rootfs it had
+	if isMountPoint(mntUrl) {
+		return
+	}
 	lowerDir := fmt.Sprintf(OverlayLower, imageName)
 	upperDir := fmt.Sprintf(WriteLayerUrl, containerName)
 	workDir := fmt.Sprintf(OverlayWork, containerName)
@@ -106,6 +110,9 @@ func mountVolume(containerName string, volumeUrls []string) {
 	if err := os.MkdirAll(containerVolumeDir, 0777); err != nil {
 		log.Infof("mkdir container dir %s error. %v", containerVolumeDir, err)
 	}
+	if isMountPoint(containerVolumeDir) {
+		return
+	}
 
 	// mount the host file directory to the container mount point
 	cmd := exec.Command("mount", "--bind", parentUrl, containerVolumeDir)
@@ -116,6 +123,25 @@ func mountVolume(containerName string, volumeUrls []string) {
 	}
 }
 
+// isMountPoint reports whether path is a mount point in the current mount namespace.
+func isMountPoint(path string) bool {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		log.Errorf("read mountinfo error: %v", err)
+		return false
+	}
+	path = filepath.Clean(path)
+	for _, line := range strings.Split(string(data), "\n") {
+		// the fifth field is the mount point
+		fields := strings.Fields(line)
+		if len(fields) > 4 && fields[4] == path {
+			return true
+		}
+	}
+
+	return false
+}
+
 func pathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -0,0 +1,243 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	JSONFileDriver = "json-file"
+
+	compressSuffix = ".gz"
+)
+
+// JSONFile is the default log driver, it appends one JSON object per message to a file.
+// With max-size the file is rotated once it grows over the limit, keeping max-file files
+// in total: path is the current one, path.1 the newest rotated one, and so on.
+type JSONFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+
+	maxSize  int64 // 0 means no rotation
+	maxFiles int
+	compress bool
+}
+
+// NewJSONFile opens the log file at path, the messages are appended to what it already holds.
+// The supported options are max-size, max-file and compress.
+func NewJSONFile(path string, options map[string]string) (*JSONFile, error) {
+	l := &JSONFile{path: path, maxFiles: 1}
+	if err := l.parseOptions(options); err != nil {
+		return nil, err
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// open opens the log file for appending, and takes its size as the size already logged.
+func (l *JSONFile) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("open log file %s error %v", l.path, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = stat.Size()
+
+	return nil
+}
+
+func (l *JSONFile) parseOptions(options map[string]string) error {
+	var err error
+	for key, value := range options {
+		switch key {
+		case "max-size":
+			if l.maxSize, err = parseSize(value); err != nil {
+				return err
+			}
+		case "max-file":
+			if l.maxFiles, err = strconv.Atoi(value); err != nil || l.maxFiles < 1 {
+				return fmt.Errorf("invalid max-file %q, it must be at least 1", value)
+			}
+		case "compress":
+			if l.compress, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid compress %q", value)
+			}
+		default:
+			return fmt.Errorf("unknown log opt %q for %s log driver", key, JSONFileDriver)
+		}
+	}
+	if l.maxFiles > 1 && l.maxSize == 0 {
+		return fmt.Errorf("max-file can only be used with max-size")
+	}
+
+	return nil
+}
+
+func (l *JSONFile) Log(msg *Message) error {
+	data, err := sonic.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal log message error %v", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		// opening it again failed last time
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	// a file that could not be rotated is written over the limit rather than losing the message
+	var rotateErr error
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if rotateErr = l.rotate(); l.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+func (l *JSONFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// rotate moves every rotated file one place up, dropping the oldest one,
+// and starts over with an empty file. With a single file it is just truncated.
+// The file at path is opened again whether the rotation succeeded or not.
+func (l *JSONFile) rotate() error {
+	err := l.file.Close()
+	l.file = nil
+	if err == nil {
+		err = l.shift()
+	}
+	if openErr := l.open(); err == nil {
+		err = openErr
+	}
+
+	return err
+}
+
+// shift makes room for a new log file at path.
+func (l *JSONFile) shift() error {
+	if l.maxFiles == 1 {
+		if err := os.Truncate(l.path, 0); err != nil {
+			return fmt.Errorf("truncate log file %s error %v", l.path, err)
+		}
+		return nil
+	}
+
+	for i := l.maxFiles - 1; i > 1; i-- {
+		from, to := rotatedName(l.path, i-1), rotatedName(l.path, i)
+		renameIfExists(from, to)
+		renameIfExists(from+compressSuffix, to+compressSuffix)
+	}
+	first := rotatedName(l.path, 1)
+	if err := os.Rename(l.path, first); err != nil {
+		return fmt.Errorf("rotate log file %s error %v", l.path, err)
+	}
+	if l.compress {
+		// the rotated file is kept as it is, it is read just as well
+		if err := compressFile(first); err != nil {
+			log.Warnf("compress log file %s error %v", first, err)
+		}
+	}
+
+	return nil
+}
+
+func rotatedName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+func renameIfExists(from string, to string) {
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		os.Remove(from)
+	}
+}
+
+// compressFile replaces the file at path by its gzip compressed copy at path.gz.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// written aside first so that a reader never sees a partial archive
+	tmp := path + compressSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("compress log file %s error %v", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("compress log file %s error %v", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+compressSuffix); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// parseSize parses a size such as 512, 100k, 10m or 1g.
+func parseSize(value string) (int64, error) {
+	units := map[string]int64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+	number, unit := strings.ToLower(value), int64(1)
+	number = strings.TrimSuffix(number, "b")
+	if n := len(number); n > 0 {
+		if u, ok := units[number[n-1:]]; ok {
+			number, unit = number[:n-1], u
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return size * unit, nil
+}
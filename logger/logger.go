@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+
+	// maxChunkSize bounds a message when the output has no newline for a long time
+	maxChunkSize = 16 * 1024
+
+	// logErrorInterval is the least time between two reports of a log driver failing on a stream
+	logErrorInterval = time.Minute
+)
+
+// Message is a chunk of the output of a container: a line,
+// or a part of one when the line is long or not terminated yet.
+type Message struct {
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+	Log    string    `json:"log"`
+}
+
+// Logger is where a log driver receives the output of a container.
+// Log is called from one goroutine per stream.
+type Logger interface {
+	Log(msg *Message) error
+	Close() error
+}
+
+// Copy logs what is read from src as stream until src is closed.
+// Everything read is also written to mirror as is, unless it is nil.
+// The messages the log driver fails to log are dropped, its errors do not stop the copy.
+func Copy(l Logger, stream string, src io.Reader, mirror io.Writer) error {
+	w := NewWriter(IgnoreErrors(l), stream)
+	var dst io.Writer = w
+	if mirror != nil {
+		dst = io.MultiWriter(mirror, w)
+	}
+
+	_, err := io.Copy(dst, src)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// IgnoreErrors returns l reporting the errors of its Log instead of returning them: a log driver
+// failing, on a full disk or with its syslog server down, loses messages but must never stall
+// the output of the container. The errors are reported at most once per logErrorInterval.
+// Like any Logger, the one returned is used from one goroutine per stream.
+func IgnoreErrors(l Logger) Logger {
+	return &errorReporter{Logger: l}
+}
+
+type errorReporter struct {
+	Logger
+	lastReport time.Time
+	failures   int
+}
+
+func (l *errorReporter) Log(msg *Message) error {
+	if err := l.Logger.Log(msg); err != nil {
+		l.failures++
+		if time.Since(l.lastReport) >= logErrorInterval {
+			log.Errorf("log %s failed %d times since the last report, error %v", msg.Stream, l.failures, err)
+			l.lastReport = time.Now()
+			l.failures = 0
+		}
+	}
+	return nil
+}
+
+// Writer logs what is written to it as stream, one message per line.
+// A line is held until its end is written, or it is logged in parts once too long.
+type Writer struct {
+	logger  Logger
+	stream  string
+	pending []byte
+}
+
+func NewWriter(l Logger, stream string) *Writer {
+	return &Writer{logger: l, stream: stream}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		size := bytes.IndexByte(w.pending, '\n') + 1
+		if size == 0 || size > maxChunkSize {
+			if len(w.pending) < maxChunkSize {
+				break
+			}
+			// the line is too long, log it in parts
+			size = maxChunkSize
+		}
+		if err := w.log(w.pending[:size]); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[size:]
+	}
+	// do not let the already logged prefix pin a growing buffer
+	w.pending = append([]byte(nil), w.pending...)
+
+	return len(p), nil
+}
+
+// Close logs the unterminated line left, if any.
+func (w *Writer) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	err := w.log(w.pending)
+	w.pending = nil
+	return err
+}
+
+func (w *Writer) log(chunk []byte) error {
+	return w.logger.Log(&Message{Stream: w.stream, Time: time.Now().UTC(), Log: string(chunk)})
+}
+
+// Config selects the log driver of a container and its options.
+type Config struct {
+	Driver  string            `json:"driver"`
+	Options map[string]string `json:"options"`
+}
+
+// Info describes the container a log driver works for.
+type Info struct {
+	ContainerID   string
+	ContainerName string
+	// LogPath is where a file based driver writes.
+	LogPath string
+}
+
+// New creates the log driver described by config.
+func New(config Config, info Info) (Logger, error) {
+	switch config.Driver {
+	case "", JSONFileDriver:
+		return NewJSONFile(info.LogPath, config.Options)
+	case SyslogDriver:
+		return NewSyslog(info, config.Options)
+	default:
+		return nil, fmt.Errorf("unknown log driver %q", config.Driver)
+	}
+}
+
+// ValidateConfig checks config without creating the driver.
+func ValidateConfig(config Config) error {
+	switch config.Driver {
+	case "", JSONFileDriver:
+		return (&JSONFile{maxFiles: 1}).parseOptions(config.Options)
+	case SyslogDriver:
+		return (&Syslog{}).parseOptions(config.Options)
+	default:
+		return fmt.Errorf("unknown log driver %q", config.Driver)
+	}
+}
@@ -0,0 +1,222 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryLogger struct {
+	messages []*Message
+}
+
+func (l *memoryLogger) Log(msg *Message) error {
+	l.messages = append(l.messages, msg)
+	return nil
+}
+
+func (l *memoryLogger) Close() error {
+	return nil
+}
+
+func TestCopy(t *testing.T) {
+	long := strings.Repeat("x", maxChunkSize+10)
+	input := "first\nsecond\n" + long + "\nno newline"
+
+	l := &memoryLogger{}
+	var mirror bytes.Buffer
+	if err := Copy(l, Stderr, strings.NewReader(input), &mirror); err != nil {
+		t.Fatal(err)
+	}
+	if mirror.String() != input {
+		t.Fatal("mirror did not receive the output as is")
+	}
+
+	var logged strings.Builder
+	for _, msg := range l.messages {
+		if msg.Stream != Stderr {
+			t.Fatalf("stream %s, want %s", msg.Stream, Stderr)
+		}
+		if len(msg.Log) > maxChunkSize {
+			t.Fatalf("message of %d bytes exceeds the chunk size", len(msg.Log))
+		}
+		logged.WriteString(msg.Log)
+	}
+	if logged.String() != input {
+		t.Fatal("logged messages do not add up to the output")
+	}
+	if l.messages[0].Log != "first\n" || l.messages[1].Log != "second\n" {
+		t.Fatalf("lines not logged one per message: %q %q", l.messages[0].Log, l.messages[1].Log)
+	}
+	if last := l.messages[len(l.messages)-1].Log; last != "no newline" {
+		t.Fatalf("unterminated line logged as %q", last)
+	}
+}
+
+type failingLogger struct {
+	calls int
+}
+
+func (l *failingLogger) Log(msg *Message) error {
+	l.calls++
+	return errors.New("no space left on device")
+}
+
+func (l *failingLogger) Close() error {
+	return nil
+}
+
+func TestCopyDriverError(t *testing.T) {
+	input := "first\nsecond\nthird"
+
+	l := &failingLogger{}
+	var mirror bytes.Buffer
+	if err := Copy(l, Stdout, strings.NewReader(input), &mirror); err != nil {
+		t.Fatalf("copy stopped on a log driver error: %v", err)
+	}
+	if mirror.String() != input {
+		t.Fatalf("mirror received %q", mirror.String())
+	}
+	if l.calls != 3 {
+		t.Fatalf("log driver called %d times, want 3", l.calls)
+	}
+}
+
+func TestReadJSONLog(t *testing.T) {
+	path := t.TempDir() + "/container.log"
+	l, err := NewJSONFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5000; i++ {
+		stream := Stdout
+		if i%2 == 1 {
+			stream = Stderr
+		}
+		l.Log(&Message{Stream: stream, Time: start.Add(time.Duration(i) * time.Second), Log: fmt.Sprintf("line \"%d\"\n", i)})
+	}
+	l.Close()
+
+	read := func(config *ReadConfig) []string {
+		var got []string
+		if err := ReadJSONLog(path, config, func(msg *Message) error {
+			got = append(got, msg.Log)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := read(&ReadConfig{Tail: -1}); len(got) != 5000 || got[0] != "line \"0\"\n" {
+		t.Fatalf("read %d messages, first %q", len(got), got[0])
+	}
+	if got := read(&ReadConfig{Tail: 3}); len(got) != 3 || got[0] != "line \"4997\"\n" {
+		t.Fatalf("tail 3 read %q", got)
+	}
+	if got := read(&ReadConfig{Tail: 2, Stream: Stdout}); len(got) != 2 || got[0] != "line \"4996\"\n" || got[1] != "line \"4998\"\n" {
+		t.Fatalf("tail 2 of stdout read %q", got)
+	}
+	if got := read(&ReadConfig{Tail: 0}); len(got) != 0 {
+		t.Fatalf("tail 0 read %q", got)
+	}
+	got := read(&ReadConfig{Tail: -1, Since: start.Add(10 * time.Second), Until: start.Add(12 * time.Second)})
+	if len(got) != 3 || got[0] != "line \"10\"\n" {
+		t.Fatalf("since until read %q", got)
+	}
+}
+
+func TestJSONFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/container.log"
+	l, err := NewJSONFile(path, map[string]string{"max-size": "1k", "max-file": "3", "compress": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		l.Log(&Message{Stream: Stdout, Log: fmt.Sprintf("%d\n", i)})
+	}
+	l.Close()
+
+	files, err := logFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[0] != path+".2.gz" || files[1] != path+".1.gz" || files[2] != path {
+		t.Fatalf("log files %q", files)
+	}
+
+	var got []string
+	if err := ReadJSONLog(path, &ReadConfig{Tail: -1}, func(msg *Message) error {
+		got = append(got, msg.Log)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[len(got)-1] != "199\n" {
+		t.Fatalf("read %q", got)
+	}
+	for i := 1; i < len(got); i++ {
+		var prev, cur int
+		fmt.Sscanf(got[i-1], "%d", &prev)
+		fmt.Sscanf(got[i], "%d", &cur)
+		if cur != prev+1 {
+			t.Fatalf("messages out of order across files: %q then %q", got[i-1], got[i])
+		}
+	}
+
+	// more than the current file holds
+	tail := len(got) - 5
+	var tailed []string
+	if err := ReadJSONLog(path, &ReadConfig{Tail: tail}, func(msg *Message) error {
+		tailed = append(tailed, msg.Log)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tailed) != tail || tailed[0] != got[5] {
+		t.Fatalf("tail %d read %d messages starting with %q", tail, len(tailed), tailed[0])
+	}
+}
+
+func TestJSONFileCompressError(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/container.log"
+	// the compressed copy can not be written aside
+	if err := os.Mkdir(path+".1.gz.tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewJSONFile(path, map[string]string{"max-size": "100", "max-file": "2", "compress": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := l.Log(&Message{Stream: Stdout, Log: fmt.Sprintf("%d\n", i)}); err != nil {
+			t.Fatalf("log %d error %v", i, err)
+		}
+	}
+	l.Close()
+
+	files, err := logFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != path+".1" || files[1] != path {
+		t.Fatalf("log files %q", files)
+	}
+	var got []string
+	if err := ReadJSONLog(path, &ReadConfig{Tail: -1}, func(msg *Message) error {
+		got = append(got, msg.Log)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[len(got)-1] != "9\n" {
+		t.Fatalf("read %q after a failed compression", got)
+	}
+}
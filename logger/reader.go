@@ -0,0 +1,350 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	// tailBlockSize is how much is read at once when looking for the last messages
+	tailBlockSize = 32 * 1024
+	// followInterval is how often a followed log is checked for new messages
+	followInterval = 200 * time.Millisecond
+)
+
+// ReadConfig selects the messages read from a log.
+type ReadConfig struct {
+	// Stream only reads the messages of one stream, every stream if empty.
+	Stream string
+	// Since and Until bound the time of the messages, zero means unbounded.
+	Since time.Time
+	Until time.Time
+	// Tail only reads the last Tail messages, every message if negative.
+	Tail int
+	// Follow keeps waiting for new messages while Alive reports the container may still write.
+	Follow bool
+	Alive  func() bool
+}
+
+func (c *ReadConfig) match(msg *Message) bool {
+	if c.Stream != "" && msg.Stream != c.Stream {
+		return false
+	}
+	if !c.Since.IsZero() && msg.Time.Before(c.Since) {
+		return false
+	}
+	if !c.Until.IsZero() && msg.Time.After(c.Until) {
+		return false
+	}
+	return true
+}
+
+// ReadJSONLog reads the messages written by JSONFile at path, the rotated files first,
+// calling fn for each of them that matches config.
+// The files are read one line at a time, and from their end when only the last messages are wanted.
+func ReadJSONLog(path string, config *ReadConfig, fn func(msg *Message) error) error {
+	files, err := logFiles(path)
+	if err != nil {
+		return err
+	}
+
+	// find the file and the position in it the wanted messages start at
+	first, offset, skip := 0, int64(0), 0
+	if config.Tail >= 0 {
+		need := config.Tail
+		for first = len(files) - 1; first >= 0 && need > 0; first-- {
+			name := files[first]
+			if strings.HasSuffix(name, compressSuffix) {
+				count, err := countCompressed(name, config.match)
+				if err != nil {
+					return err
+				}
+				if count >= need {
+					skip = count - need
+					break
+				}
+				need -= count
+				continue
+			}
+			var count int
+			offset, count, err = tailOffset(name, need, config.match)
+			if err != nil {
+				return err
+			}
+			if count == need {
+				break
+			}
+			need -= count
+		}
+		if first < 0 {
+			first, offset, skip = 0, 0, 0
+		}
+		if config.Tail == 0 {
+			first, offset = len(files)-1, -1
+		}
+	}
+
+	for i := first; i < len(files)-1; i++ {
+		if err := readFile(files[i], offset, skip, config, fn); err != nil {
+			return err
+		}
+		offset, skip = 0, 0
+	}
+
+	current, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if first == len(files)-1 {
+		whence := io.SeekStart
+		if offset < 0 {
+			offset, whence = 0, io.SeekEnd
+		}
+		if _, err := current.Seek(offset, whence); err != nil {
+			current.Close()
+			return err
+		}
+	}
+
+	return followMessages(path, current, config, fn)
+}
+
+// logFiles lists the rotated files of the log at path from the oldest one, followed by path itself.
+func logFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	var rotated []string
+	for _, name := range matches {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, path+"."), compressSuffix))
+		if err != nil {
+			// a compression in progress
+			continue
+		}
+		index[name] = n
+		rotated = append(rotated, name)
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		return index[rotated[i]] > index[rotated[j]]
+	})
+
+	return append(rotated, path), nil
+}
+
+// readFile calls fn for the messages of a rotated file, from offset in a plain file,
+// after skipping skip matching messages in a compressed one.
+func readFile(name string, offset int64, skip int, config *ReadConfig, fn func(msg *Message) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// rotated away meanwhile
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, compressSuffix) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("read log file %s error %v", name, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return decodeMessages(r, func(msg *Message) error {
+		if !config.match(msg) {
+			return nil
+		}
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		return fn(msg)
+	})
+}
+
+// decodeMessages calls fn for every complete message read from r.
+func decodeMessages(r io.Reader, fn func(msg *Message) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the rest of the line, if any, is still being written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg Message
+		if err := sonic.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("unmarshal log message error %v", err)
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// followMessages decodes the messages of the current log file until its end,
+// or until the container can not write anymore when following.
+// A followed file that is rotated is read to its end before moving on to the new one.
+func followMessages(path string, file *os.File, config *ReadConfig, fn func(msg *Message) error) error {
+	defer func() {
+		file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	var line []byte
+	exited, drained := false, false
+	for {
+		data, err := reader.ReadBytes('\n')
+		line = append(line, data...)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			if !config.Follow || exited {
+				return nil
+			}
+			if !config.Until.IsZero() && time.Now().After(config.Until) {
+				return nil
+			}
+			if isRotated(path, file) {
+				// the writer may have written to it right before rotating, read it once more
+				if !drained {
+					drained = true
+					continue
+				}
+				next, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				file.Close()
+				file = next
+				reader.Reset(file)
+				line, drained = nil, false
+				continue
+			}
+			// read once more after the container exits, it may have written before that
+			exited = config.Alive != nil && !config.Alive()
+			if !exited {
+				time.Sleep(followInterval)
+			}
+			continue
+		}
+
+		var msg Message
+		if err := sonic.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("unmarshal log message error %v", err)
+		}
+		line = nil
+		if !config.match(&msg) {
+			continue
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// isRotated reports whether path is no longer the file being read.
+func isRotated(path string, file *os.File) bool {
+	current, err := os.Stat(path)
+	if err != nil {
+		// between the rename and the creation of the new file
+		return false
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(current, stat)
+}
+
+// countCompressed counts the messages that match in a compressed rotated file.
+func countCompressed(name string, match func(msg *Message) bool) (int, error) {
+	count := 0
+	err := readFile(name, 0, 0, &ReadConfig{Tail: -1}, func(msg *Message) error {
+		if match(msg) {
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// tailOffset returns where the last n messages that match start in the file at name,
+// reading it backwards one block at a time. When the file holds fewer of them,
+// it returns 0 and how many it holds.
+func tailOffset(name string, n int, match func(msg *Message) bool) (int64, int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// buf holds the lines between bufStart and the start of the last counted message
+	bufStart := stat.Size()
+	var buf []byte
+	count := 0
+	for {
+		body := bytes.TrimSuffix(buf, []byte{'\n'})
+		i := bytes.LastIndexByte(body, '\n')
+		if i < 0 && bufStart > 0 {
+			// the line starts in an earlier block
+			size := min(int64(tailBlockSize), bufStart)
+			block := make([]byte, size, int(size)+len(buf))
+			if _, err := file.ReadAt(block, bufStart-size); err != nil {
+				return 0, 0, err
+			}
+			buf = append(block, buf...)
+			bufStart -= size
+			continue
+		}
+
+		lineStart := i + 1
+		if line := buf[lineStart:]; len(line) > 0 {
+			var msg Message
+			// an unterminated last line is still being written, it is not counted
+			if bytes.HasSuffix(line, []byte{'\n'}) && sonic.Unmarshal(line, &msg) == nil && match(&msg) {
+				count++
+				if count == n {
+					return bufStart + int64(lineStart), count, nil
+				}
+			}
+		}
+		buf = buf[:lineStart]
+		if len(buf) == 0 && bufStart == 0 {
+			return 0, count, nil
+		}
+	}
+}
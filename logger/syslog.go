@@ -0,0 +1,206 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SyslogDriver = "syslog"
+
+	defaultSyslogAddress = "unix:///dev/log"
+	// syslogSDID identifies the structured data zdocker adds, 32473 is the enterprise number reserved for examples
+	syslogSDID = "zdocker@32473"
+
+	severityErr  = 3
+	severityInfo = 6
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog sends the output of a container as RFC 5424 messages to a syslog endpoint,
+// the app name is the container name and the proc id the container id.
+// stdout is logged with the info severity, stderr with the err one.
+type Syslog struct {
+	mu   sync.Mutex
+	conn net.Conn
+	// stream sockets need the messages to be delimited, datagrams carry one each
+	stream bool
+
+	network  string
+	address  string
+	facility int
+	hostname string
+	info     Info
+}
+
+// NewSyslog connects to the endpoint given by the syslog-address option,
+// unix:///dev/log when it is not set. The supported options are syslog-address and syslog-facility.
+func NewSyslog(info Info, options map[string]string) (*Syslog, error) {
+	l := &Syslog{info: info}
+	if err := l.parseOptions(options); err != nil {
+		return nil, err
+	}
+
+	l.hostname, _ = os.Hostname()
+	if l.hostname == "" {
+		l.hostname = "-"
+	}
+	if err := l.connect(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Syslog) parseOptions(options map[string]string) error {
+	address := defaultSyslogAddress
+	l.facility = syslogFacilities["daemon"]
+	for key, value := range options {
+		switch key {
+		case "syslog-address":
+			address = value
+		case "syslog-facility":
+			facility, ok := syslogFacilities[value]
+			if !ok {
+				return fmt.Errorf("invalid syslog facility %q", value)
+			}
+			l.facility = facility
+		default:
+			return fmt.Errorf("unknown log opt %q for %s log driver", key, SyslogDriver)
+		}
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid syslog address %q", address)
+	}
+	switch u.Scheme {
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return fmt.Errorf("invalid syslog address %q, missing the socket path", address)
+		}
+		l.network, l.address = u.Scheme, u.Path
+	case "udp":
+		if u.Host == "" {
+			return fmt.Errorf("invalid syslog address %q, missing the host", address)
+		}
+		l.network, l.address = u.Scheme, u.Host
+		if u.Port() == "" {
+			l.address = net.JoinHostPort(u.Hostname(), "514")
+		}
+	default:
+		return fmt.Errorf("unsupported syslog address %q (supported: unix://, unixgram://, udp://)", address)
+	}
+
+	return nil
+}
+
+func (l *Syslog) connect() error {
+	if l.network != "unix" {
+		conn, err := net.Dial(l.network, l.address)
+		if err != nil {
+			return fmt.Errorf("connect to syslog %s error %v", l.address, err)
+		}
+		l.conn, l.stream = conn, false
+		return nil
+	}
+
+	// a local syslog daemon listens on a datagram socket most of the time
+	if conn, err := net.Dial("unixgram", l.address); err == nil {
+		l.conn, l.stream = conn, false
+		return nil
+	}
+	conn, err := net.Dial("unix", l.address)
+	if err != nil {
+		return fmt.Errorf("connect to syslog %s error %v", l.address, err)
+	}
+	l.conn, l.stream = conn, true
+
+	return nil
+}
+
+func (l *Syslog) Log(msg *Message) error {
+	data := l.format(msg)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.conn.Write(data); err != nil {
+		// the syslog daemon may have been restarted, try once with a new connection
+		l.conn.Close()
+		if err := l.connect(); err != nil {
+			return err
+		}
+		_, err = l.conn.Write(data)
+		return err
+	}
+
+	return nil
+}
+
+func (l *Syslog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.conn.Close()
+}
+
+// format builds the RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [STRUCTURED-DATA] MSG
+func (l *Syslog) format(msg *Message) []byte {
+	severity := severityInfo
+	if msg.Stream == Stderr {
+		severity = severityErr
+	}
+
+	data := fmt.Sprintf("<%d>1 %s %s %s %s %s [%s name=\"%s\" id=\"%s\"] %s",
+		l.facility*8+severity,
+		msg.Time.Format(time.RFC3339Nano),
+		l.hostname,
+		syslogField(l.info.ContainerName, 48),
+		syslogField(l.info.ContainerID, 128),
+		msg.Stream,
+		syslogSDID,
+		escapeSDValue(l.info.ContainerName),
+		escapeSDValue(l.info.ContainerID),
+		strings.TrimSuffix(msg.Log, "\n"),
+	)
+	if l.stream {
+		data += "\n"
+	}
+
+	return []byte(data)
+}
+
+// syslogField makes s a valid header field: printable ascii without spaces, at most limit characters.
+func syslogField(s string, limit int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if field == "" {
+		return "-"
+	}
+	if len(field) > limit {
+		field = field[:limit]
+	}
+	return field
+}
+
+// escapeSDValue escapes the characters RFC 5424 does not allow as is in a structured data value.
+func escapeSDValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
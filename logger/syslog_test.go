@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSyslog(t *testing.T) {
+	socket := t.TempDir() + "/log.sock"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	l, err := NewSyslog(Info{ContainerID: "1234567890", ContainerName: "web"}, map[string]string{
+		"syslog-address":  "unix://" + socket,
+		"syslog-facility": "local0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	l.Log(&Message{Stream: Stdout, Time: now, Log: "hello\n"})
+	l.Log(&Message{Stream: Stderr, Time: now, Log: "oops\n"})
+
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^<134>1 2025-01-02T03:04:05Z \S+ web 1234567890 stdout \[zdocker@32473 name="web" id="1234567890"\] hello$`),
+		regexp.MustCompile(`^<131>1 2025-01-02T03:04:05Z \S+ web 1234567890 stderr \[zdocker@32473 name="web" id="1234567890"\] oops$`),
+	}
+	buf := make([]byte, 1024)
+	for _, re := range want {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !re.Match(buf[:n]) {
+			t.Fatalf("syslog message %q does not match %s", buf[:n], re)
+		}
+	}
+}
+
+func TestSyslogOptions(t *testing.T) {
+	invalid := []map[string]string{
+		{"syslog-address": "tcp://localhost:514"},
+		{"syslog-address": "unix://"},
+		{"syslog-facility": "nope"},
+		{"max-size": "10m"},
+	}
+	for _, options := range invalid {
+		if err := (&Syslog{}).parseOptions(options); err == nil {
+			t.Fatalf("options %v accepted", options)
+		}
+	}
+
+	l := &Syslog{}
+	if err := l.parseOptions(map[string]string{"syslog-address": "udp://10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if l.network != "udp" || l.address != "10.0.0.1:514" {
+		t.Fatalf("udp address parsed as %s %s", l.network, l.address)
+	}
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os/exec"
@@ -73,7 +74,18 @@ func (b *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 }
 
 func (b *BridgeNetworkDriver) Disconnect(network *Network, endpoint *Endpoint) error {
-	return nil
+	// The veth pair is destroyed along with the network namespace of the container,
+	// so the host side is usually gone already by the time the container exits.
+	veth, err := netlink.LinkByName(endpoint.ID[:5])
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+
+	return netlink.LinkDel(veth)
 }
 
 func (b *BridgeNetworkDriver) Name() string {
@@ -139,10 +139,14 @@ func Connect(networkName string, cinfo *container.ContainerInfo) error {
 		return fmt.Errorf("no Such Network: %s", networkName)
 	}
 
-	// Assign container IP address
-	ip, err := ipAllocator.Allocate(network.IpRange)
-	if err != nil {
-		return err
+	// Assign container IP address, a restarted container keeps the address it had
+	ip := net.ParseIP(cinfo.IPAddress).To4()
+	if ip == nil {
+		var err error
+		ip, err = ipAllocator.Allocate(network.IpRange)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Create network endpoints
@@ -153,18 +157,70 @@ func Connect(networkName string, cinfo *container.ContainerInfo) error {
 		PortMapping: cinfo.PortMapping,
 	}
 	// Call network driver to mount and configure network endpoints
-	if err = drivers[network.Driver].Connect(network, ep); err != nil {
+	if err := drivers[network.Driver].Connect(network, ep); err != nil {
 		return err
 	}
 
 	// Configure the container network device IP address in the container's namespace.
-	if err = configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
+	if err := configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
 		return err
 	}
+	cinfo.IPAddress = ip.String()
 
 	return configPortMapping(ep)
 }
 
+// Allocate assigns the container an address of the network ahead of Connect,
+// which keeps the address a container already has.
+func Allocate(networkName string, cinfo *container.ContainerInfo) error {
+	network, ok := networks[networkName]
+	if !ok {
+		return fmt.Errorf("no Such Network: %s", networkName)
+	}
+	if net.ParseIP(cinfo.IPAddress).To4() != nil {
+		return nil
+	}
+
+	ip, err := ipAllocator.Allocate(network.IpRange)
+	if err != nil {
+		return err
+	}
+	cinfo.IPAddress = ip.String()
+
+	return nil
+}
+
+// Disconnect releases what Connect set up for the container: the port mapping rules,
+// the veth device and the container IP address.
+func Disconnect(networkName string, cinfo *container.ContainerInfo) error {
+	network, ok := networks[networkName]
+	if !ok {
+		return fmt.Errorf("no Such Network: %s", networkName)
+	}
+
+	ep := &Endpoint{
+		ID:          fmt.Sprintf("%s-%s", cinfo.ID, networkName),
+		IPAddress:   net.ParseIP(cinfo.IPAddress),
+		Network:     network,
+		PortMapping: cinfo.PortMapping,
+	}
+	if ep.IPAddress == nil {
+		// the container never got an address, nothing else was set up either
+		return nil
+	}
+
+	deletePortMapping(ep)
+
+	if err := drivers[network.Driver].Disconnect(network, ep); err != nil {
+		log.Errorf("error disconnect endpoint %s: %v", ep.ID, err)
+	}
+
+	// Release modifies the address it is given
+	ip := make(net.IP, len(ep.IPAddress))
+	copy(ip, ep.IPAddress)
+	return ipAllocator.Release(network.IpRange, &ip)
+}
+
 func configEndpointIpAddressAndRoute(ep *Endpoint, cinfo *container.ContainerInfo) error {
 	peerLink, err := netlink.LinkByName(ep.Device.PeerName)
 	if err != nil {
@@ -259,9 +315,13 @@ func configPortMapping(ep *Endpoint) error {
 			log.Errorf("port mapping format error, %v", pm)
 			continue
 		}
-		iptablesCmd := fmt.Sprintf("-t nat -A PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+		rule := fmt.Sprintf("PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
 			portMapping[0], ep.IPAddress.String(), portMapping[1])
-		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
+		// the rule is still there when a restarted container keeps its address
+		if err := exec.Command("iptables", strings.Split("-t nat -C "+rule, " ")...).Run(); err == nil {
+			continue
+		}
+		cmd := exec.Command("iptables", strings.Split("-t nat -A "+rule, " ")...)
 		output, err := cmd.Output()
 		if err != nil {
 			log.Errorf("iptables Output, %v", output)
@@ -271,6 +331,22 @@ func configPortMapping(ep *Endpoint) error {
 	return nil
 }
 
+func deletePortMapping(ep *Endpoint) {
+	for _, pm := range ep.PortMapping {
+		portMapping := strings.Split(pm, ":")
+		if len(portMapping) != 2 {
+			continue
+		}
+		iptablesCmd := fmt.Sprintf("-t nat -D PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+			portMapping[0], ep.IPAddress.String(), portMapping[1])
+		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Errorf("iptables Output, %v", output)
+		}
+	}
+}
+
 func (nw *Network) dump(dumpPath string) error {
 	if _, err := os.Stat(dumpPath); err != nil {
 		if os.IsNotExist(err) {
@@ -9,16 +9,95 @@ package nsenter
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <limits.h>
 #include <sys/wait.h>
+#include <sys/ioctl.h>
 #include <sys/mount.h>
+#include <sys/stat.h>
 #include <sys/syscall.h>
 #include <signal.h>
 
 #define ZDOCKER_INIT_ENV "ZDOCKER_INIT"
+#define ZDOCKER_TTY_ENV "ZDOCKER_TTY"
+#define ZDOCKER_PID_FD_ENV "ZDOCKER_PID_FD"
+#define ZDOCKER_EXEC_CGROUP_ENV "zdocker_cgroup"
 
 // clone flags for container creation
 #define CLONE_FLAGS (CLONE_NEWUTS | CLONE_NEWPID | CLONE_NEWNS | CLONE_NEWNET | CLONE_NEWIPC)
 
+// wait_and_exit waits for pid and exits the same way it did.
+static void wait_and_exit(pid_t pid) {
+	int status;
+	while (waitpid(pid, &status, 0) == -1) {
+		if (errno != EINTR) {
+			fprintf(stderr, "zdocker: wait failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
+	if (WIFSIGNALED(status)) {
+		// re-raise the signal so that our parent sees which signal killed the process
+		int sig = WTERMSIG(status);
+		signal(sig, SIG_DFL);
+		kill(getpid(), sig);
+		exit(128 + sig);
+	}
+	exit(WEXITSTATUS(status));
+}
+
+// The namespaces an exec joins, in this order: the user namespace first since it owns the others,
+// the mount namespace late since the paths of the remaining ones are resolved in it.
+static const char *exec_namespaces[] = { "user", "ipc", "uts", "net", "pid", "mnt", "cgroup", "time" };
+#define EXEC_NAMESPACES_LEN (sizeof(exec_namespaces) / sizeof(exec_namespaces[0]))
+
+// join_namespaces joins the namespaces of the process pid. A namespace the kernel does not have,
+// or that we are already in, is skipped: joining our own user namespace is not allowed.
+// Any other failure is fatal, the command must not run half inside the container.
+static void join_namespaces(const char *pid) {
+	int fds[EXEC_NAMESPACES_LEN];
+	char nspath[PATH_MAX];
+	char selfpath[PATH_MAX];
+	struct stat target, self;
+	size_t i;
+
+	// all of them are opened before joining any, /proc is another one in the mount namespace of the container
+	for (i = 0; i < EXEC_NAMESPACES_LEN; i++) {
+		fds[i] = -1;
+		snprintf(nspath, sizeof(nspath), "/proc/%s/ns/%s", pid, exec_namespaces[i]);
+		snprintf(selfpath, sizeof(selfpath), "/proc/self/ns/%s", exec_namespaces[i]);
+		if (stat(selfpath, &self) == -1) {
+			if (errno == ENOENT) {
+				// not supported by the kernel
+				continue;
+			}
+			fprintf(stderr, "zdocker: stat %s failed: %s\n", selfpath, strerror(errno));
+			exit(1);
+		}
+		if (stat(nspath, &target) == -1) {
+			fprintf(stderr, "zdocker: stat %s failed: %s\n", nspath, strerror(errno));
+			exit(1);
+		}
+		if (self.st_dev == target.st_dev && self.st_ino == target.st_ino) {
+			continue;
+		}
+		fds[i] = open(nspath, O_RDONLY | O_CLOEXEC);
+		if (fds[i] == -1) {
+			fprintf(stderr, "zdocker: open %s failed: %s\n", nspath, strerror(errno));
+			exit(1);
+		}
+	}
+
+	for (i = 0; i < EXEC_NAMESPACES_LEN; i++) {
+		if (fds[i] == -1) {
+			continue;
+		}
+		if (setns(fds[i], 0) == -1) {
+			fprintf(stderr, "zdocker: setns on %s namespace of process %s failed: %s\n", exec_namespaces[i], pid, strerror(errno));
+			exit(1);
+		}
+		close(fds[i]);
+	}
+}
+
 // The attribute ((constructor)) here means that the function will be executed automatically once the package is referenced.
 // This runs BEFORE Go runtime starts
 __attribute__((constructor)) void zdocker_init(void) {
@@ -31,35 +110,68 @@ __attribute__((constructor)) void zdocker_init(void) {
 		return;
 	}
 
+	// The fd on which the host pid of the process run in the container is reported to the Go parent,
+	// our own pid is useless to it since it refers to the intermediate process.
+	int report_fd = -1;
+	char *zdocker_pid_fd = getenv(ZDOCKER_PID_FD_ENV);
+	if (zdocker_pid_fd) {
+		report_fd = atoi(zdocker_pid_fd);
+	}
+
 	// Check if this is an exec into existing container
 	char *zdocker_pid;
 	zdocker_pid = getenv("zdocker_pid");
 	if (zdocker_pid) {
-		// This is exec into existing container - use original logic
-		char *zdocker_cmd;
-		zdocker_cmd = getenv("zdocker_cmd");
-		if (!zdocker_cmd) {
-			return;
+		// join the cgroup of the container first, its limits apply to the command forked below,
+		// and the mount namespace of the container does not have the cgroup filesystem
+		char *zdocker_cgroup = getenv(ZDOCKER_EXEC_CGROUP_ENV);
+		if (zdocker_cgroup) {
+			int cgroup_fd = open(zdocker_cgroup, O_WRONLY);
+			if (cgroup_fd == -1 || dprintf(cgroup_fd, "%d", getpid()) < 0) {
+				fprintf(stderr, "zdocker: join cgroup %s failed: %s\n", zdocker_cgroup, strerror(errno));
+				exit(1);
+			}
+			close(cgroup_fd);
 		}
 
-		int i;
-		char nspath[1024];
-		char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+		join_namespaces(zdocker_pid);
 
-		for (i=0; i<5; i++) {
-			sprintf(nspath, "/proc/%s/ns/%s", zdocker_pid, namespaces[i]);
-			int fd = open(nspath, O_RDONLY);
-
-			if (setns(fd, 0) == -1) {
-				// fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
-			} else {
-				// fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
+		// Joining the pid namespace only applies to our children, so the command runs in a child:
+		// it continues into the Go runtime, which sets up the process and execs the command.
+		pid_t exec_pid = fork();
+		if (exec_pid == -1) {
+			fprintf(stderr, "zdocker: fork failed: %s\n", strerror(errno));
+			exit(1);
+		}
+		if (exec_pid == 0) {
+			if (report_fd >= 0) {
+				close(report_fd);
 			}
-			close(fd);
+			// the command leads its own session in the container with the pty as controlling terminal,
+			// a shell could not give the terminal back to a process group outside of its pid namespace
+			char *zdocker_tty = getenv(ZDOCKER_TTY_ENV);
+			if (zdocker_tty && strcmp(zdocker_tty, "1") == 0) {
+				if (setsid() == -1) {
+					fprintf(stderr, "zdocker: setsid failed: %s\n", strerror(errno));
+					exit(1);
+				}
+				if (ioctl(STDIN_FILENO, TIOCSCTTY, 0) == -1) {
+					fprintf(stderr, "zdocker: set controlling terminal failed: %s\n", strerror(errno));
+					exit(1);
+				}
+			}
+			return;
 		}
-		int res = system(zdocker_cmd);
-		exit(0);
-		return;
+
+		if (report_fd >= 0) {
+			dprintf(report_fd, "%d", exec_pid);
+			close(report_fd);
+		}
+
+		// like system(), leave the terminal signals to the command and report how it ended
+		signal(SIGINT, SIG_IGN);
+		signal(SIGQUIT, SIG_IGN);
+		wait_and_exit(exec_pid);
 	}
 
 	// Check if this should create a new container
@@ -70,8 +182,8 @@ __attribute__((constructor)) void zdocker_init(void) {
 		return;
 	}
 
-	// This is container creation - we need to clone with namespaces
-	fprintf(stdout, "zdocker: creating container with namespaces\n");
+	// This is container creation - we need to clone with namespaces.
+	// Nothing is printed on success, stdout and stderr already belong to the container.
 
 	// Create pipe for communication
 	int pipefd[2];
@@ -91,6 +203,9 @@ __attribute__((constructor)) void zdocker_init(void) {
 	if (child_pid == 0) {
 		// Child process - this will become the container init
 		close(pipefd[0]); // Close read end
+		if (report_fd >= 0) {
+			close(report_fd);
+		}
 
 		// Set environment variable to indicate this is container init
 		if (setenv(ZDOCKER_INIT_ENV, "1", 1) != 0) {
@@ -98,6 +213,21 @@ __attribute__((constructor)) void zdocker_init(void) {
 			exit(1);
 		}
 
+		// With a tty the container init becomes a session leader and takes the pty on stdin
+		// as its controlling terminal, so job control and ctrl-c work inside the container
+		// while this intermediate process stays out of the terminal's process group.
+		char *zdocker_tty = getenv(ZDOCKER_TTY_ENV);
+		if (zdocker_tty && strcmp(zdocker_tty, "1") == 0) {
+			if (setsid() == -1) {
+				fprintf(stderr, "zdocker: setsid failed: %s\n", strerror(errno));
+				exit(1);
+			}
+			if (ioctl(STDIN_FILENO, TIOCSCTTY, 0) == -1) {
+				fprintf(stderr, "zdocker: set controlling terminal failed: %s\n", strerror(errno));
+				exit(1);
+			}
+		}
+
 		// Write child PID to pipe (for parent to read)
 		pid_t my_pid = getpid();
 		if (write(pipefd[1], &my_pid, sizeof(my_pid)) != sizeof(my_pid)) {
@@ -121,10 +251,13 @@ __attribute__((constructor)) void zdocker_init(void) {
 	}
 	close(pipefd[0]);
 
-	// Wait for child and exit
-	int status;
-	waitpid(child_pid, &status, 0);
-	exit(WEXITSTATUS(status));
+	if (report_fd >= 0) {
+		// the child sees itself as pid 1, clone returned its pid in our namespace
+		dprintf(report_fd, "%d", child_pid);
+		close(report_fd);
+	}
+
+	wait_and_exit(child_pid);
 }
 */
 import "C"
@@ -0,0 +1,185 @@
+package shim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/crazyfrankie/zdocker/term"
+)
+
+// The attach protocol is deliberately small: the server streams the raw output
+// of the container to every client, clients send framed messages back.
+// A frame is a one byte type, a four bytes big endian length and the payload.
+const (
+	FrameStdin  byte = 1 // payload is input for the container
+	FrameResize byte = 2 // payload is rows and cols of the client terminal, two bytes each
+
+	maxFrameSize = 1 << 20
+	writeTimeout = 5 * time.Second
+)
+
+// AttachServer holds the stdio of a detached container
+// and shares it with the clients connected to its unix socket.
+type AttachServer struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	stdin   io.Writer
+	pty     *term.Pty
+	clients map[net.Conn]struct{}
+}
+
+// NewAttachServer listens on socketPath, SetIO tells where the input of the clients goes.
+func NewAttachServer(socketPath string) (*AttachServer, error) {
+	// remove the socket left by a previous run of the same container
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s error %v", socketPath, err)
+	}
+
+	return &AttachServer{
+		listener: listener,
+		clients:  map[net.Conn]struct{}{},
+	}, nil
+}
+
+// SetIO sets the stdio of the running container: stdin is where client input goes,
+// nil if the container has no stdin; pty is nil unless the container has a tty.
+// It is reset to nil while the container is not running.
+func (s *AttachServer) SetIO(stdin io.Writer, pty *term.Pty) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stdin = stdin
+	s.pty = pty
+}
+
+// Serve accepts clients until the server is closed.
+func (s *AttachServer) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errorf("attach accept error %v", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.clients[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handleInput(conn)
+	}
+}
+
+// Write broadcasts the output of the container to every attached client.
+// It never fails so that a broken client can not stop the output from being logged.
+func (s *AttachServer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.clients {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(p); err != nil {
+			delete(s.clients, conn)
+			conn.Close()
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close stops accepting clients and disconnects the attached ones.
+func (s *AttachServer) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.clients {
+		conn.Close()
+		delete(s.clients, conn)
+	}
+}
+
+func (s *AttachServer) handleInput(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		typ, payload, err := ReadFrame(conn)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		stdin, pty := s.stdin, s.pty
+		s.mu.Unlock()
+
+		switch typ {
+		case FrameStdin:
+			if stdin == nil {
+				continue
+			}
+			if _, err := stdin.Write(payload); err != nil {
+				log.Errorf("attach write stdin error %v", err)
+			}
+		case FrameResize:
+			if pty == nil || len(payload) != 4 {
+				continue
+			}
+			rows := binary.BigEndian.Uint16(payload[0:2])
+			cols := binary.BigEndian.Uint16(payload[2:4])
+			if err := pty.SetSize(rows, cols); err != nil {
+				log.Errorf("attach resize pty error %v", err)
+			}
+		}
+	}
+}
+
+// WriteFrame sends one frame of the attach protocol.
+func WriteFrame(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteResize sends the terminal size of the client.
+func WriteResize(w io.Writer, rows uint16, cols uint16) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint16(payload[0:2], rows)
+	binary.BigEndian.PutUint16(payload[2:4], cols)
+	return WriteFrame(w, FrameResize, payload)
+}
+
+// ReadFrame reads one frame of the attach protocol.
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame size %d exceeds limit", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], payload, nil
+}
@@ -0,0 +1,32 @@
+package shim
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, FrameStdin, []byte("echo hi\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteResize(&buf, 24, 80); err != nil {
+		t.Fatal(err)
+	}
+
+	typ, payload, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != FrameStdin || string(payload) != "echo hi\n" {
+		t.Fatalf("unexpected frame %d %q", typ, payload)
+	}
+
+	typ, payload, err = ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != FrameResize || !bytes.Equal(payload, []byte{0, 24, 0, 80}) {
+		t.Fatalf("unexpected frame %d %v", typ, payload)
+	}
+}
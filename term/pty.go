@@ -0,0 +1,80 @@
+package term
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Pty is a pseudo-terminal pair.
+// The master side stays in zdocker and is used to relay the user's terminal,
+// the slave side becomes the controlling terminal of the process in the container.
+type Pty struct {
+	Master *os.File
+	Slave  *os.File
+}
+
+// NewPty opens /dev/ptmx, unlocks the slave side and opens it.
+func NewPty() (*Pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open /dev/ptmx error: %v", err)
+	}
+
+	// equal to unlockpt(3)
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unlock pty error: %v", err)
+	}
+	// equal to ptsname(3)
+	n, err := unix.IoctlGetUint32(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("get pty number error: %v", err)
+	}
+
+	slaveName := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(slaveName, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("open %s error: %v", slaveName, err)
+	}
+
+	return &Pty{
+		Master: master,
+		Slave:  slave,
+	}, nil
+}
+
+// Resize copies the window size of the terminal `from` to the pty,
+// the kernel then delivers SIGWINCH to the foreground process group of the pty.
+func (p *Pty) Resize(from *os.File) error {
+	rows, cols, err := GetSize(from.Fd())
+	if err != nil {
+		return err
+	}
+
+	return p.SetSize(rows, cols)
+}
+
+// SetSize sets the window size of the pty.
+func (p *Pty) SetSize(rows uint16, cols uint16) error {
+	return unix.IoctlSetWinsize(int(p.Master.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+}
+
+// GetSize returns the window size of the terminal fd.
+func GetSize(fd uintptr) (uint16, uint16, error) {
+	ws, err := unix.IoctlGetWinsize(int(fd), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ws.Row, ws.Col, nil
+}
+
+// Close closes both sides of the pty.
+func (p *Pty) Close() {
+	p.Master.Close()
+	p.Slave.Close()
+}
@@ -0,0 +1,101 @@
+package term
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// IsTerminal reports whether fd refers to a terminal.
+func IsTerminal(fd uintptr) bool {
+	_, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	return err == nil
+}
+
+// SetRawTerminal puts the terminal into raw mode like cfmakeraw(3) does,
+// so that every key including ctrl-c reaches the container instead of the host shell.
+// It returns the previous state which should be handed back to RestoreTerminal.
+func SetRawTerminal(fd uintptr) (*unix.Termios, error) {
+	oldState, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+
+	newState := *oldState
+	newState.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	newState.Oflag &^= unix.OPOST
+	newState.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	newState.Cflag &^= unix.CSIZE | unix.PARENB
+	newState.Cflag |= unix.CS8
+	newState.Cc[unix.VMIN] = 1
+	newState.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(int(fd), unix.TCSETS, &newState); err != nil {
+		return nil, err
+	}
+
+	return oldState, nil
+}
+
+// RestoreTerminal restores the terminal to the state returned by SetRawTerminal.
+func RestoreTerminal(fd uintptr, state *unix.Termios) error {
+	return unix.IoctlSetTermios(int(fd), unix.TCSETS, state)
+}
+
+// Relay connects the user's terminal to the pty.
+//
+// If stdin is a terminal it is put into raw mode and its window size is kept
+// in sync with the pty by forwarding SIGWINCH. Input is copied to the pty master
+// when stdin is not nil, the output of the pty is copied to stdout.
+// The slave side must be closed by the caller once the process holding it is started,
+// otherwise reading from the master never ends.
+//
+// The returned function blocks until all the output is drained and then restores the terminal.
+func Relay(p *Pty, stdin *os.File, stdout io.Writer) func() {
+	var oldState *unix.Termios
+	if stdin != nil && IsTerminal(stdin.Fd()) {
+		state, err := SetRawTerminal(stdin.Fd())
+		if err != nil {
+			log.Warnf("set raw terminal error %v", err)
+		}
+		oldState = state
+	}
+
+	winch := make(chan os.Signal, 1)
+	if stdin != nil && IsTerminal(stdin.Fd()) {
+		if err := p.Resize(stdin); err != nil {
+			log.Warnf("resize pty error %v", err)
+		}
+		signal.Notify(winch, syscall.SIGWINCH)
+		go func() {
+			for range winch {
+				if err := p.Resize(stdin); err != nil {
+					log.Warnf("resize pty error %v", err)
+				}
+			}
+		}()
+	}
+
+	if stdin != nil {
+		go io.Copy(p.Master, stdin)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// reading from the master returns EIO once every slave fd is closed
+		io.Copy(stdout, p.Master)
+		close(done)
+	}()
+
+	return func() {
+		<-done
+		signal.Stop(winch)
+		close(winch)
+		if oldState != nil {
+			RestoreTerminal(stdin.Fd(), oldState)
+		}
+	}
+}